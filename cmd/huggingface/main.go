@@ -15,6 +15,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/lmittmann/tint"
@@ -23,20 +24,31 @@ import (
 	"github.com/mattn/go-isatty"
 )
 
-func model(ctx context.Context, hfToken, hfRepo, out string) error {
+// parseRepo parses a repository ID like "meta-llama/Llama-3.2-1B".
+func parseRepo(hfRepo, repoType string) (huggingface.RepoRef, error) {
 	parts := strings.Split(hfRepo, "/")
 	if len(parts) != 2 {
-		return fmt.Errorf("%q is not a valid huggingface repo", hfRepo)
+		return huggingface.RepoRef{}, fmt.Errorf("%q is not a valid huggingface repo", hfRepo)
 	}
-	c, err := huggingface.New(hfToken)
+	ref := huggingface.RepoRef{Type: huggingface.RepoType(repoType), Author: parts[0], Repo: parts[1]}
+	switch ref.Type {
+	case huggingface.ModelType, huggingface.DatasetType, huggingface.SpaceType:
+	default:
+		return ref, fmt.Errorf("invalid repository type %q", repoType)
+	}
+	return ref, nil
+}
+
+func model(ctx context.Context, hfToken, hfRepo, out string) error {
+	ref, err := parseRepo(hfRepo, "model")
 	if err != nil {
 		return err
 	}
-	m := huggingface.Model{ModelRef: huggingface.ModelRef{
-		Author: parts[0],
-		Repo:   parts[1],
-	},
+	c, err := huggingface.New(hfToken)
+	if err != nil {
+		return err
 	}
+	m := huggingface.Model{ModelRef: ref}
 	if err = c.GetModelInfo(ctx, &m, "main"); err != nil {
 		return err
 	}
@@ -48,6 +60,116 @@ func model(ctx context.Context, hfToken, hfRepo, out string) error {
 	return nil
 }
 
+func search(ctx context.Context, hfToken string, opts huggingface.ListModelsOptions, asJSON bool) error {
+	c, err := huggingface.New(hfToken)
+	if err != nil {
+		return err
+	}
+	var models []huggingface.Model
+	for m, err2 := range c.ListModels(ctx, opts) {
+		if err2 != nil {
+			return err2
+		}
+		models = append(models, m)
+	}
+	if asJSON {
+		b, err2 := json.MarshalIndent(models, "", "  ")
+		if err2 != nil {
+			return err2
+		}
+		fmt.Printf("%s\n", b)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MODEL\tDOWNLOADS\tLIKES\tTASK\tCREATED\n")
+	for _, m := range models {
+		created := ""
+		if !m.Created.IsZero() {
+			created = m.Created.Format(time.DateOnly)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", m.RepoID(), m.Downloads, m.Likes, m.PipelineTag, created)
+	}
+	return w.Flush()
+}
+
+func ls(ctx context.Context, hfToken string, ref huggingface.RepoRef, revision, path string, opts huggingface.ListRepoTreeOptions, asJSON bool) error {
+	c, err := huggingface.New(hfToken)
+	if err != nil {
+		return err
+	}
+	var entries []huggingface.TreeEntry
+	for e, err2 := range c.ListRepoTree(ctx, ref, revision, path, opts) {
+		if err2 != nil {
+			return err2
+		}
+		entries = append(entries, e)
+	}
+	if asJSON {
+		b, err2 := json.MarshalIndent(entries, "", "  ")
+		if err2 != nil {
+			return err2
+		}
+		fmt.Printf("%s\n", b)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		storage := "git"
+		switch {
+		case e.IsDir():
+			storage = "dir"
+		case e.XetHash != "":
+			storage = "xet"
+		case e.LFS != nil:
+			storage = "lfs"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s", storage, e.Size, e.Path)
+		if e.LastCommit != nil {
+			fmt.Fprintf(w, "\t%s\t%s\t%s", e.LastCommit.ID[:min(len(e.LastCommit.ID), 10)], e.LastCommit.Date.Format(time.DateOnly), e.LastCommit.Title)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	return w.Flush()
+}
+
+func whoami(ctx context.Context, hfToken string, asJSON bool) error {
+	c, err := huggingface.New(hfToken)
+	if err != nil {
+		return err
+	}
+	u, err := c.WhoAmI(ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		b, err2 := json.MarshalIndent(u, "", "  ")
+		if err2 != nil {
+			return err2
+		}
+		fmt.Printf("%s\n", b)
+		return nil
+	}
+	fmt.Printf("user:  %s", u.Name)
+	if u.FullName != "" {
+		fmt.Printf(" (%s)", u.FullName)
+	}
+	fmt.Printf("\n")
+	for _, o := range u.Orgs {
+		fmt.Printf("org:   %s (%s)\n", o.Name, o.Role)
+	}
+	fmt.Printf("token: %s (%s)\n", u.Token.Name, u.Token.Role)
+	if u.Token.CanReadGatedRepos {
+		fmt.Printf("  can read gated repos\n")
+	}
+	if len(u.Token.Global) != 0 {
+		fmt.Printf("  global: %s\n", strings.Join(u.Token.Global, ", "))
+	}
+	for _, s := range u.Token.Scoped {
+		fmt.Printf("  %s %s: %s\n", s.Type, s.Name, strings.Join(s.Permissions, ", "))
+	}
+	return nil
+}
+
 func mainImpl(args []string) error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	defer stop()
@@ -121,6 +243,78 @@ func mainImpl(args []string) error {
 			return errors.New("-hf-repo is required")
 		}
 		return model(ctx, *hfToken, *hfRepo, *out)
+	case "search":
+		hfToken := fs.String("hf-token", "", "HuggingFace token")
+		query := fs.String("search", "", "Substring of the model ID to search for")
+		author := fs.String("author", "", "Author or organization owning the models")
+		filter := fs.String("filter", "", "Comma separated list of tags the models must have, e.g. \"gguf,license:mit\"")
+		library := fs.String("library", "", "Library of the models, e.g. \"transformers\"")
+		pipelineTag := fs.String("pipeline-tag", "", "Task of the models, e.g. \"text-generation\"")
+		sort := fs.String("sort", "downloads", "Property to sort by, e.g. \"downloads\", \"likes\", \"lastModified\"")
+		asc := fs.Bool("asc", false, "Sort in ascending order")
+		limit := fs.Int("limit", 20, "Maximum number of models to list")
+		asJSON := fs.Bool("json", false, "Print as JSON instead of a table")
+		if fs.Parse(args[1:]) != nil {
+			return context.Canceled
+		}
+		if len(fs.Args()) != 0 {
+			return errors.New("unexpected argument")
+		}
+		if *verbose {
+			programLevel.Set(slog.LevelDebug)
+		}
+		opts := huggingface.ListModelsOptions{
+			Search:      *query,
+			Author:      *author,
+			Library:     *library,
+			PipelineTag: *pipelineTag,
+			Sort:        *sort,
+			Ascending:   *asc,
+			Limit:       *limit,
+		}
+		if *filter != "" {
+			opts.Filter = strings.Split(*filter, ",")
+		}
+		return search(ctx, *hfToken, opts, *asJSON)
+	case "ls":
+		hfToken := fs.String("hf-token", "", "HuggingFace token")
+		hfRepo := fs.String("hf-repo", "", "HuggingFace repository, e.g. \"meta-llama/Llama-3.2-1B\"")
+		repoType := fs.String("type", "model", "Repository type: model, dataset or space")
+		revision := fs.String("revision", "main", "Branch, tag or commit hash")
+		recursive := fs.Bool("r", false, "List subdirectories recursively")
+		long := fs.Bool("l", false, "Include the last commit of each entry (slower)")
+		asJSON := fs.Bool("json", false, "Print as JSON instead of a table")
+		if fs.Parse(args[1:]) != nil {
+			return context.Canceled
+		}
+		if len(fs.Args()) > 1 {
+			return errors.New("unexpected argument")
+		}
+		if *verbose {
+			programLevel.Set(slog.LevelDebug)
+		}
+		if *hfRepo == "" {
+			return errors.New("-hf-repo is required")
+		}
+		ref, err := parseRepo(*hfRepo, *repoType)
+		if err != nil {
+			return err
+		}
+		opts := huggingface.ListRepoTreeOptions{Recursive: *recursive, Expand: *long}
+		return ls(ctx, *hfToken, ref, *revision, fs.Arg(0), opts, *asJSON)
+	case "whoami":
+		hfToken := fs.String("hf-token", "", "HuggingFace token")
+		asJSON := fs.Bool("json", false, "Print as JSON")
+		if fs.Parse(args[1:]) != nil {
+			return context.Canceled
+		}
+		if len(fs.Args()) != 0 {
+			return errors.New("unexpected argument")
+		}
+		if *verbose {
+			programLevel.Set(slog.LevelDebug)
+		}
+		return whoami(ctx, *hfToken, *asJSON)
 	default:
 		fs.Usage()
 		return context.Canceled
@@ -0,0 +1,78 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
+
+// Commit is a commit in the history of a repository.
+type Commit struct {
+	// ID is the commit hash.
+	ID string
+	// Title is the first line of the commit message.
+	Title string
+	// Message is the rest of the commit message.
+	Message string
+	// Authors are the user names of the authors.
+	Authors []string
+	// Date is the time of the commit.
+	Date time.Time
+}
+
+// https://huggingface.co/docs/hub/api#get-apimodelsrepoidcommitsrevision
+type commitResponse struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Authors []struct {
+		User   string `json:"user"`
+		Avatar string `json:"avatar"`
+	} `json:"authors"`
+	Date time.Time `json:"date"`
+}
+
+// ListCommits returns the history of the revision, most recent commit first.
+//
+// The results are fetched lazily one page at a time. Iteration stops after the
+// first error.
+func (c *Client) ListCommits(ctx context.Context, ref RepoRef, revision string) iter.Seq2[Commit, error] {
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/commits/" + escapeRevision(revision)
+	return func(yield func(Commit, error) bool) {
+		for r, err := range listPages[commitResponse](ctx, c, u) {
+			if err != nil {
+				yield(Commit{}, err)
+				return
+			}
+			cm := Commit{ID: r.ID, Title: r.Title, Message: r.Message, Date: r.Date}
+			for _, a := range r.Authors {
+				cm.Authors = append(cm.Authors, a.User)
+			}
+			if !yield(cm, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ResolveRevisionAt returns the hash of the commit that was the head of branch
+// at the time t.
+//
+// The result can be passed as the revision to EnsureFile or EnsureSnapshot to
+// fetch the files as they were at that time.
+func (c *Client) ResolveRevisionAt(ctx context.Context, ref RepoRef, branch string, t time.Time) (string, error) {
+	for cm, err := range c.ListCommits(ctx, ref, branch) {
+		if err != nil {
+			return "", err
+		}
+		if !cm.Date.After(t) {
+			return cm.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%s@%s has no commit before %s", ref.RepoID(), branch, t.Format(time.RFC3339))
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolveRevisionAt(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/models/a/b/commits/main" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("p") == "" {
+			w.Header().Set("Link", "<"+server.URL+r.URL.Path+"?p=1>; rel=\"next\"")
+			w.Write([]byte(`[
+				{"id":"3333333333333333333333333333333333333333","title":"Third","message":"","authors":[{"user":"alice"}],"date":"2024-03-01T00:00:00.000Z"},
+				{"id":"2222222222222222222222222222222222222222","title":"Second","message":"","authors":[{"user":"bob"},{"user":"alice"}],"date":"2024-02-01T00:00:00.000Z"}
+			]`))
+			return
+		}
+		w.Write([]byte(`[
+			{"id":"1111111111111111111111111111111111111111","title":"Initial commit","message":"","authors":[],"date":"2024-01-01T00:00:00.000Z"}
+		]`))
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref := RepoRef{Author: "a", Repo: "b"}
+	data := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), "3333333333333333333333333333333333333333"},
+		{time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), "2222222222222222222222222222222222222222"},
+		{time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), "1111111111111111111111111111111111111111"},
+	}
+	for _, l := range data {
+		got, err := c.ResolveRevisionAt(ctx, ref, "main", l.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != l.want {
+			t.Fatalf("%s: want %s, got %s", l.t, l.want, got)
+		}
+	}
+	if _, err = c.ResolveRevisionAt(ctx, ref, "main", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected error")
+	}
+	var authors [][]string
+	for cm, err := range c.ListCommits(ctx, ref, "main") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		authors = append(authors, cm.Authors)
+	}
+	if len(authors) != 3 || len(authors[1]) != 2 || authors[1][0] != "bob" {
+		t.Fatalf("unexpected authors %q", authors)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Dataset is a dataset stored on https://huggingface.co
+type Dataset struct {
+	RepoRef
+
+	// Information filled by GetDatasetInfo():
+
+	// Description is the short description of the dataset.
+	Description string
+	// License is the license of the dataset as stated in its card.
+	License string
+	// Tags is the list of tags of the dataset.
+	Tags []string
+	// Downloads is the number of downloads in the last 30 days.
+	Downloads int64
+	// Likes is the number of likes.
+	Likes int64
+	// Files is the list of files in the repository.
+	Files []string
+	// Created is the time the repository was created.
+	Created time.Time
+	// Modified is the last time the repository was modified.
+	Modified time.Time
+	// SHA of the reference requested.
+	SHA string
+
+	_ struct{}
+}
+
+// https://huggingface.co/docs/hub/api#get-apidatasetsrepoid-or-apidatasetsrepoidrevisionrevision
+type datasetInfoResponse struct {
+	HiddenID         string         `json:"_id"`
+	ID               string         `json:"id"`
+	Author           string         `json:"author"`
+	SHA              string         `json:"sha"`
+	CardData         map[string]any `json:"cardData"`
+	Citation         string         `json:"citation"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	Description      string         `json:"description"`
+	Disabled         bool           `json:"disabled"`
+	Downloads        int64          `json:"downloads"`
+	Gated            any            `json:"gated"`
+	LastModified     time.Time      `json:"lastModified"`
+	Likes            int64          `json:"likes"`
+	PapersWithCodeID string         `json:"paperswithcode_id"`
+	Private          bool           `json:"private"`
+	Siblings         []struct {
+		Filename string `json:"rfilename"`
+	} `json:"siblings"`
+	Tags        []string `json:"tags"`
+	UsedStorage int64    `json:"usedStorage"`
+}
+
+// GetDatasetInfo fills the supplied Dataset with information from the
+// HuggingFace Hub.
+//
+// Use "main" as ref unless you need a specific commit.
+func (c *Client) GetDatasetInfo(ctx context.Context, d *Dataset, ref string) error {
+	d.Type = DatasetType
+	slog.Info("hf", "dataset", d.RepoID())
+	url := c.serverBase + "/api/datasets/" + d.RepoID() + "/revision/" + escapeRevision(ref)
+	resp, err := c.request(ctx, c.h, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list dataset %s: %w", d.RepoID(), err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// Unlike models, unknown fields are ignored as the schema varies a lot
+	// between datasets.
+	r := datasetInfoResponse{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		slog.Error("hf", "dataset", d.RepoID(), "data", string(b))
+		return fmt.Errorf("failed to parse dataset %s response: %w", d.RepoID(), err)
+	}
+	d.Description = r.Description
+	d.License, _ = r.CardData["license"].(string)
+	d.Tags = r.Tags
+	d.Downloads = r.Downloads
+	d.Likes = r.Likes
+	d.Files = make([]string, len(r.Siblings))
+	for i := range r.Siblings {
+		d.Files[i] = r.Siblings[i].Filename
+	}
+	d.Created = r.CreatedAt
+	d.Modified = r.LastModified
+	d.SHA = r.SHA
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestGetDatasetInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/datasets/openai/gsm8k/revision/main" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		w.Write([]byte(apiDatasetGSM8KData))
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Dataset{RepoRef: RepoRef{Author: "openai", Repo: "gsm8k"}}
+	if err := c.GetDatasetInfo(context.Background(), &got, "main"); err != nil {
+		t.Fatal(err)
+	}
+	want := Dataset{
+		RepoRef:     RepoRef{Type: DatasetType, Author: "openai", Repo: "gsm8k"},
+		Description: "Grade school math.",
+		License:     "mit",
+		Tags:        []string{"task_categories:text2text-generation", "license:mit"},
+		Downloads:   330000,
+		Likes:       600,
+		Files:       []string{".gitattributes", "README.md", "main/test-00000-of-00001.parquet"},
+		Created:     time.Date(2022, 3, 2, 23, 29, 22, 0, time.UTC),
+		Modified:    time.Date(2024, 1, 4, 12, 5, 15, 0, time.UTC),
+		SHA:         "e53f048856ff4f594e959d75785d2c2d37b678ee",
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(want, RepoRef{})); diff != "" {
+		t.Fatal(diff)
+	}
+	if u := got.URL(); u != "https://huggingface.co/datasets/openai/gsm8k" {
+		t.Fatal(u)
+	}
+}
+
+const apiDatasetGSM8KData = `{
+  "_id": "621ffdd236468d709f181d5e",
+  "id": "openai/gsm8k",
+  "author": "openai",
+  "sha": "e53f048856ff4f594e959d75785d2c2d37b678ee",
+  "lastModified": "2024-01-04T12:05:15.000Z",
+  "private": false,
+  "gated": false,
+  "disabled": false,
+  "downloads": 330000,
+  "likes": 600,
+  "tags": ["task_categories:text2text-generation", "license:mit"],
+  "cardData": {"license": "mit", "pretty_name": "Grade School Math 8K"},
+  "description": "Grade school math.",
+  "paperswithcode_id": "gsm8k",
+  "createdAt": "2022-03-02T23:29:22.000Z",
+  "siblings": [
+    {"rfilename": ".gitattributes"},
+    {"rfilename": "README.md"},
+    {"rfilename": "main/test-00000-of-00001.parquet"}
+  ],
+  "usedStorage": 12345
+}`
+
+func TestEnsureSnapshot_Dataset(t *testing.T) {
+	ref := RepoRef{Type: DatasetType, Author: "author", Repo: "data"}
+	_, c := newFakeHubRepo(t, ref, map[string][]byte{"train.csv": []byte("a,b\n1,2\n")})
+	got, err := c.EnsureSnapshot(context.Background(), ref, "main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(c.hubCacheDir, "datasets--author--data", "snapshots", fakeCommit, "train.csv")
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("unexpected files %q", got)
+	}
+	if b, err := os.ReadFile(got[0]); err != nil || string(b) != "a,b\n1,2\n" {
+		t.Fatalf("unexpected content %q: %v", b, err)
+	}
+}
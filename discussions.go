@@ -0,0 +1,336 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Discussion is a discussion or a pull request on a repository.
+type Discussion struct {
+	// Num is the number of the discussion in the repository.
+	Num int
+	// Title is the title.
+	Title string
+	// Status is "open", "closed", "merged" or "draft".
+	Status string
+	// Author is the user name of the author.
+	Author string
+	// IsPullRequest is true for pull requests.
+	IsPullRequest bool
+	// Created is the time the discussion was opened.
+	Created time.Time
+
+	// Information filled by GetDiscussion():
+
+	// Events are the comments, status changes, commits and title changes, in
+	// chronological order.
+	Events []DiscussionEvent `json:",omitempty"`
+	// GitRef is the reference of a pull request, e.g. "refs/pr/1". Use it as
+	// the revision to download or to push commits to the pull request.
+	GitRef string `json:",omitempty"`
+	// TargetBranch is the reference a pull request is to be merged into.
+	TargetBranch string `json:",omitempty"`
+	// MergeCommit is the commit hash of a merged pull request.
+	MergeCommit string `json:",omitempty"`
+	// Diff is the diff of a pull request.
+	Diff string `json:",omitempty"`
+
+	_ struct{}
+}
+
+// DiscussionEvent is an event in a Discussion.
+//
+// The fields set depend on Type.
+type DiscussionEvent struct {
+	// ID is the ID of the event.
+	ID string
+	// Type is "comment", "status-change", "commit" or "title-change".
+	Type string
+	// Author is the user name of the author.
+	Author string
+	// Created is the time of the event.
+	Created time.Time
+
+	// Content is the raw text of a comment.
+	Content string `json:",omitempty"`
+	// Edited is true when a comment was edited.
+	Edited bool `json:",omitempty"`
+	// Hidden is true when a comment was hidden.
+	Hidden bool `json:",omitempty"`
+	// NewStatus is the status set by a status change.
+	NewStatus string `json:",omitempty"`
+	// Summary is the title of a commit.
+	Summary string `json:",omitempty"`
+	// OID is the hash of a commit.
+	OID string `json:",omitempty"`
+	// OldTitle is the title before a title change.
+	OldTitle string `json:",omitempty"`
+	// NewTitle is the title after a title change.
+	NewTitle string `json:",omitempty"`
+
+	_ struct{}
+}
+
+// ListDiscussionsOptions filters the discussions returned by ListDiscussions.
+//
+// All fields are optional.
+type ListDiscussionsOptions struct {
+	// Type is "discussion" or "pull_request". Both are returned when empty.
+	Type string
+	// Status is "open" or "closed". Both are returned when empty.
+	Status string
+	// Author is the user name of the author.
+	Author string
+
+	_ struct{}
+}
+
+type discussionAuthor struct {
+	Name string `json:"name"`
+}
+
+// https://huggingface.co/docs/hub/api#get-apimodelsrepoiddiscussions
+type discussionResponse struct {
+	Num           int              `json:"num"`
+	Title         string           `json:"title"`
+	Status        string           `json:"status"`
+	Author        discussionAuthor `json:"author"`
+	IsPullRequest bool             `json:"isPullRequest"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	Events        []eventResponse  `json:"events"`
+	Changes       struct {
+		Base          string `json:"base"`
+		MergeCommitID string `json:"mergeCommitId"`
+	} `json:"changes"`
+	Diff string `json:"diff"`
+}
+
+type eventResponse struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Author    discussionAuthor `json:"author"`
+	Data      struct {
+		// comment
+		Edited bool `json:"edited"`
+		Hidden bool `json:"hidden"`
+		Latest struct {
+			Raw string `json:"raw"`
+		} `json:"latest"`
+		// status-change
+		Status string `json:"status"`
+		// commit
+		Subject string `json:"subject"`
+		OID     string `json:"oid"`
+		// title-change
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"data"`
+}
+
+type discussionsPage struct {
+	Discussions []discussionResponse `json:"discussions"`
+	Count       int                  `json:"count"`
+	Start       int                  `json:"start"`
+}
+
+func (r *discussionResponse) to(d *Discussion) {
+	d.Num = r.Num
+	d.Title = r.Title
+	d.Status = r.Status
+	d.Author = r.Author.Name
+	d.IsPullRequest = r.IsPullRequest
+	d.Created = r.CreatedAt
+	if r.IsPullRequest {
+		d.GitRef = "refs/pr/" + strconv.Itoa(r.Num)
+	}
+	d.TargetBranch = r.Changes.Base
+	d.MergeCommit = r.Changes.MergeCommitID
+	d.Diff = r.Diff
+	d.Events = nil
+	for i := range r.Events {
+		d.Events = append(d.Events, r.Events[i].to())
+	}
+}
+
+func (r *eventResponse) to() DiscussionEvent {
+	return DiscussionEvent{
+		ID:        r.ID,
+		Type:      r.Type,
+		Author:    r.Author.Name,
+		Created:   r.CreatedAt,
+		Content:   r.Data.Latest.Raw,
+		Edited:    r.Data.Edited,
+		Hidden:    r.Data.Hidden,
+		NewStatus: r.Data.Status,
+		Summary:   r.Data.Subject,
+		OID:       r.Data.OID,
+		OldTitle:  r.Data.From,
+		NewTitle:  r.Data.To,
+	}
+}
+
+// ListDiscussions returns the discussions and pull requests of the
+// repository matching opts, most recent first.
+//
+// The results are fetched lazily one page at a time. Iteration stops after the
+// first error.
+func (c *Client) ListDiscussions(ctx context.Context, ref RepoRef, opts ListDiscussionsOptions) iter.Seq2[Discussion, error] {
+	v := url.Values{}
+	if opts.Type != "" {
+		v.Set("type", opts.Type)
+	}
+	if opts.Status != "" {
+		v.Set("status", opts.Status)
+	}
+	if opts.Author != "" {
+		v.Set("author", opts.Author)
+	}
+	return func(yield func(Discussion, error) bool) {
+		for p := 0; ; p++ {
+			v.Set("p", strconv.Itoa(p))
+			page := discussionsPage{}
+			if _, err := c.getJSON(ctx, c.discussionsURL(ref)+"?"+v.Encode(), &page); err != nil {
+				yield(Discussion{}, err)
+				return
+			}
+			for i := range page.Discussions {
+				d := Discussion{}
+				page.Discussions[i].to(&d)
+				if !yield(d, nil) {
+					return
+				}
+			}
+			if len(page.Discussions) == 0 || page.Start+len(page.Discussions) >= page.Count {
+				return
+			}
+		}
+	}
+}
+
+// GetDiscussion returns the discussion or pull request num with its events
+// and, for a pull request, its diff.
+func (c *Client) GetDiscussion(ctx context.Context, ref RepoRef, num int) (*Discussion, error) {
+	r := discussionResponse{}
+	if _, err := c.getJSON(ctx, c.discussionURL(ref, num)+"?diff=1", &r); err != nil {
+		return nil, fmt.Errorf("failed to get discussion #%d: %w", num, err)
+	}
+	d := &Discussion{}
+	r.to(d)
+	return d, nil
+}
+
+type createDiscussionRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	PullRequest bool   `json:"pullRequest"`
+}
+
+// CreateDiscussion opens a discussion on the repository.
+func (c *Client) CreateDiscussion(ctx context.Context, ref RepoRef, title, description string) (*Discussion, error) {
+	return c.createDiscussion(ctx, ref, title, description, false)
+}
+
+// CreatePullRequest opens a draft pull request on the repository.
+//
+// Push changes to it with CreateCommit using the returned Discussion.GitRef as
+// the revision.
+func (c *Client) CreatePullRequest(ctx context.Context, ref RepoRef, title, description string) (*Discussion, error) {
+	return c.createDiscussion(ctx, ref, title, description, true)
+}
+
+func (c *Client) createDiscussion(ctx context.Context, ref RepoRef, title, description string, pr bool) (*Discussion, error) {
+	req := createDiscussionRequest{Title: title, Description: description, PullRequest: pr}
+	r := discussionResponse{}
+	if err := c.sendJSON(ctx, "POST", c.discussionsURL(ref), nil, &req, &r); err != nil {
+		return nil, fmt.Errorf("failed to create discussion: %w", err)
+	}
+	// The response only contains the number.
+	d := &Discussion{Num: r.Num, Title: title, IsPullRequest: pr, Status: "open"}
+	if pr {
+		d.Status = "draft"
+		d.GitRef = "refs/pr/" + strconv.Itoa(r.Num)
+	}
+	return d, nil
+}
+
+type commentRequest struct {
+	Comment string `json:"comment"`
+}
+
+type commentResponse struct {
+	NewMessage eventResponse `json:"newMessage"`
+}
+
+// CommentDiscussion adds a comment to the discussion or pull request num.
+func (c *Client) CommentDiscussion(ctx context.Context, ref RepoRef, num int, comment string) (*DiscussionEvent, error) {
+	r := commentResponse{}
+	if err := c.sendJSON(ctx, "POST", c.discussionURL(ref, num)+"/comment", nil, &commentRequest{Comment: comment}, &r); err != nil {
+		return nil, fmt.Errorf("failed to comment on discussion #%d: %w", num, err)
+	}
+	e := r.NewMessage.to()
+	return &e, nil
+}
+
+type statusRequest struct {
+	Status  string `json:"status"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type statusResponse struct {
+	NewStatus eventResponse `json:"newStatus"`
+}
+
+// ChangeDiscussionStatus sets the status of the discussion or pull request num
+// to "open" or "closed", with an optional comment.
+func (c *Client) ChangeDiscussionStatus(ctx context.Context, ref RepoRef, num int, status, comment string) (*DiscussionEvent, error) {
+	if status != "open" && status != "closed" {
+		return nil, fmt.Errorf("invalid status %q", status)
+	}
+	r := statusResponse{}
+	if err := c.sendJSON(ctx, "PATCH", c.discussionURL(ref, num)+"/status", nil, &statusRequest{Status: status, Comment: comment}, &r); err != nil {
+		return nil, fmt.Errorf("failed to change the status of discussion #%d: %w", num, err)
+	}
+	e := r.NewStatus.to()
+	return &e, nil
+}
+
+// MergePullRequest merges the pull request num into its target branch, with
+// an optional comment.
+//
+// The commit cached for the target branch is invalidated.
+func (c *Client) MergePullRequest(ctx context.Context, ref RepoRef, num int, comment string) error {
+	// Get the target branch first, since the merge response doesn't have it.
+	r := discussionResponse{}
+	if _, err := c.getJSON(ctx, c.discussionURL(ref, num), &r); err != nil {
+		return fmt.Errorf("failed to get pull request #%d: %w", num, err)
+	}
+	req := struct {
+		Comment string `json:"comment,omitempty"`
+	}{comment}
+	if err := c.sendJSON(ctx, "POST", c.discussionURL(ref, num)+"/merge", nil, &req, nil); err != nil {
+		return fmt.Errorf("failed to merge pull request #%d: %w", num, err)
+	}
+	branch := strings.TrimPrefix(r.Changes.Base, "refs/heads/")
+	if branch == "" {
+		branch = "main"
+	}
+	return c.invalidateRef(ref, "refs/heads/", branch)
+}
+
+func (c *Client) discussionsURL(ref RepoRef) string {
+	return c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/discussions"
+}
+
+func (c *Client) discussionURL(ref RepoRef, num int) string {
+	return c.discussionsURL(ref) + "/" + strconv.Itoa(num)
+}
@@ -0,0 +1,224 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestListDiscussions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/models/a/b/discussions" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("type") != "pull_request" || q.Get("status") != "open" || q.Get("author") != "bob" {
+			t.Errorf("unexpected query, got: %s", r.URL.RawQuery)
+		}
+		switch q.Get("p") {
+		case "0":
+			w.Write([]byte(`{"discussions":[
+				{"num":3,"title":"Add GGUF","status":"open","author":{"name":"bob"},"isPullRequest":true,"createdAt":"2024-03-01T00:00:00.000Z"},
+				{"num":2,"title":"Fix config","status":"open","author":{"name":"bob"},"isPullRequest":true,"createdAt":"2024-02-01T00:00:00.000Z"}
+			],"count":3,"start":0}`))
+		case "1":
+			w.Write([]byte(`{"discussions":[
+				{"num":1,"title":"Typo","status":"open","author":{"name":"bob"},"isPullRequest":true,"createdAt":"2024-01-01T00:00:00.000Z"}
+			],"count":3,"start":2}`))
+		default:
+			t.Errorf("unexpected page %q", q.Get("p"))
+		}
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	opts := ListDiscussionsOptions{Type: "pull_request", Status: "open", Author: "bob"}
+	for d, err := range c.ListDiscussions(context.Background(), RepoRef{Author: "a", Repo: "b"}, opts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.GitRef != "refs/pr/"+strconv.Itoa(d.Num) {
+			t.Fatalf("unexpected ref %q", d.GitRef)
+		}
+		got = append(got, d.Num)
+	}
+	if diff := cmp.Diff([]int{3, 2, 1}, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDiscussion(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, r.Method+" "+r.URL.RequestURI()+" "+string(b))
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/datasets/a/d/discussions/4":
+			w.Write([]byte(apiDiscussionData))
+		case "POST /api/datasets/a/d/discussions":
+			w.Write([]byte(`{"num":5,"url":"https://huggingface.co/datasets/a/d/discussions/5"}`))
+		case "POST /api/datasets/a/d/discussions/4/comment":
+			w.Write([]byte(`{"newMessage":{"id":"e3","type":"comment","createdAt":"2024-05-03T00:00:00.000Z","author":{"name":"me"},"data":{"edited":false,"hidden":false,"latest":{"raw":"LGTM"}}}}`))
+		case "PATCH /api/datasets/a/d/discussions/4/status":
+			w.Write([]byte(`{"newStatus":{"id":"e4","type":"status-change","createdAt":"2024-05-04T00:00:00.000Z","author":{"name":"me"},"data":{"status":"closed"}}}`))
+		case "POST /api/datasets/a/d/discussions/4/merge":
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	c, err := New("hf_secret", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref := RepoRef{Type: DatasetType, Author: "a", Repo: "d"}
+	d, err := c.GetDiscussion(ctx, ref, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Discussion{
+		Num:           4,
+		Title:         "Add parquet",
+		Status:        "open",
+		Author:        "bob",
+		IsPullRequest: true,
+		Created:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Events: []DiscussionEvent{
+			{ID: "e1", Type: "comment", Author: "bob", Created: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Content: "Please review", Edited: true},
+			{ID: "e2", Type: "commit", Author: "bob", Created: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), Summary: "Upload data", OID: "1111111111111111111111111111111111111111"},
+		},
+		GitRef:       "refs/pr/4",
+		TargetBranch: "refs/heads/main",
+		Diff:         "diff --git a/x b/x\n",
+	}
+	if diff := cmp.Diff(want, d, cmpopts.IgnoreUnexported(Discussion{}, DiscussionEvent{})); diff != "" {
+		t.Fatal(diff)
+	}
+	pr, err := c.CreatePullRequest(ctx, ref, "New split", "Adds a split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Num != 5 || pr.GitRef != "refs/pr/5" || pr.Status != "draft" {
+		t.Fatalf("unexpected PR %#v", pr)
+	}
+	e, err := c.CommentDiscussion(ctx, ref, 4, "LGTM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Content != "LGTM" {
+		t.Fatalf("unexpected comment %#v", e)
+	}
+	if e, err = c.ChangeDiscussionStatus(ctx, ref, 4, "closed", "Superseded"); err != nil {
+		t.Fatal(err)
+	}
+	if e.NewStatus != "closed" {
+		t.Fatalf("unexpected status change %#v", e)
+	}
+	if _, err = c.ChangeDiscussionStatus(ctx, ref, 4, "merged", ""); err == nil {
+		t.Fatal("expected error")
+	}
+	// The target branch commit is cached.
+	refsDir := c.refsDir(ref)
+	if err = os.MkdirAll(refsDir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(refsDir, "main"), []byte(fakeCommit), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.MergePullRequest(ctx, ref, 4, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(refsDir, "main")); !os.IsNotExist(err) {
+		t.Fatalf("the cached target branch was not invalidated: %v", err)
+	}
+	wantReqs := []string{
+		"GET /api/datasets/a/d/discussions/4?diff=1 ",
+		`POST /api/datasets/a/d/discussions {"title":"New split","description":"Adds a split","pullRequest":true}`,
+		`POST /api/datasets/a/d/discussions/4/comment {"comment":"LGTM"}`,
+		`PATCH /api/datasets/a/d/discussions/4/status {"status":"closed","comment":"Superseded"}`,
+		"GET /api/datasets/a/d/discussions/4 ",
+		"POST /api/datasets/a/d/discussions/4/merge {}",
+	}
+	if diff := cmp.Diff(wantReqs, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestCreateCommit_PullRequest(t *testing.T) {
+	var commitURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/a/b/preupload/refs/pr/1":
+			w.Write([]byte(`{"files":[{"path":"README.md","uploadMode":"regular","shouldIgnore":false}]}`))
+		case "/api/models/a/b/commit/refs/pr/1":
+			commitURL = r.URL.EscapedPath()
+			w.Write([]byte(`{"success":true,"commitOid":"` + fakeCommit + `"}`))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	c, err := New("hf_secret", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []CommitOperation{{Path: "README.md", Content: []byte("# b")}}
+	info, err := c.CreateCommit(context.Background(), RepoRef{Author: "a", Repo: "b"}, ops, CommitOptions{Revision: "refs/pr/1", Summary: "Update README"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SHA != fakeCommit || commitURL != "/api/models/a/b/commit/refs%2Fpr%2F1" {
+		t.Fatal(info.SHA, commitURL)
+	}
+}
+
+var apiDiscussionData = `{
+  "num": 4,
+  "title": "Add parquet",
+  "status": "open",
+  "author": {"name": "bob", "avatarUrl": "/avatars/bob.svg", "type": "user"},
+  "repo": {"name": "a/d", "type": "dataset"},
+  "isPullRequest": true,
+  "createdAt": "2024-05-01T00:00:00.000Z",
+  "pinned": false,
+  "locked": false,
+  "events": [
+    {
+      "id": "e1",
+      "type": "comment",
+      "createdAt": "2024-05-01T00:00:00.000Z",
+      "author": {"name": "bob"},
+      "data": {"edited": true, "hidden": false, "latest": {"raw": "Please review", "html": "<p>Please review</p>"}, "numEdits": 1}
+    },
+    {
+      "id": "e2",
+      "type": "commit",
+      "createdAt": "2024-05-02T00:00:00.000Z",
+      "author": {"name": "bob"},
+      "data": {"subject": "Upload data", "oid": "1111111111111111111111111111111111111111"}
+    }
+  ],
+  "changes": {"base": "refs/heads/main"},
+  "filesWithConflicts": [],
+  "diff": "diff --git a/x b/x\n"
+}`
@@ -0,0 +1,379 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// maxDownloadAttempts is the number of times a blob is downloaded before
+// giving up when its content doesn't match its etag.
+const maxDownloadAttempts = 3
+
+// CorruptedError is returned when the content downloaded doesn't hash to the
+// expected etag, even after retrying.
+type CorruptedError struct {
+	// URL is the URL that was downloaded.
+	URL string
+	// Want is the expected hash, the etag.
+	Want string
+	// Got is the hash of the content received.
+	Got string
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("downloading %s: content is corrupted: expected hash %s, got %s", e.URL, e.Want, e.Got)
+}
+
+// newBlobHash returns the hash to verify the content against etag.
+//
+// Files stored in git have the git blob SHA-1 as etag, LFS files have the
+// sha256 of the content.
+func newBlobHash(etag string, size int64) hash.Hash {
+	if reSHA1.MatchString(etag) {
+		h := &gitBlobHash{Hash: sha1.New(), size: size}
+		h.Reset()
+		return h
+	}
+	return sha256.New()
+}
+
+// gitBlobHash computes the git object ID of a blob of known size, which is the
+// SHA-1 of "blob <size>\x00" followed by the content.
+type gitBlobHash struct {
+	hash.Hash
+	size int64
+}
+
+// Reset resets the hash to the state after the header.
+func (g *gitBlobHash) Reset() {
+	g.Hash.Reset()
+	fmt.Fprintf(g.Hash, "blob %d\x00", g.size)
+}
+
+// downloadBlob downloads url into blob and, when verify is true, verifies that
+// its hash is etag.
+//
+// The content is first written to blob + ".incomplete". If this file is
+// present from a previous interrupted download, the transfer is resumed with
+// an HTTP Range request from its current size. The file is flushed to disk and
+// renamed to blob only once complete and verified, so blob is never partial.
+//
+// On hash mismatch, the content is discarded and the download is retried. It
+// returns a *CorruptedError if the content is still corrupted after
+// maxDownloadAttempts attempts.
+//
+// When probeXet is true and the download starts from scratch, it returns a
+// *xetAvailableError without downloading anything if the Hub's response tells
+// the file is stored on Xet.
+func (c *Client) downloadBlob(ctx context.Context, url, blob, etag string, verify, probeXet bool, size int64, pr *fileProgress) error {
+	tmp := blob + ".incomplete"
+	for i := 0; ; i++ {
+		got, err := c.downloadTmp(ctx, url, tmp, etag, probeXet, size, pr)
+		if err != nil {
+			return err
+		}
+		if !verify || got == etag {
+			return os.Rename(tmp, blob)
+		}
+		if err = os.Remove(tmp); err != nil {
+			return err
+		}
+		if i+1 == maxDownloadAttempts {
+			return &CorruptedError{URL: url, Want: etag, Got: got}
+		}
+		slog.Warn("hf", "message", "hash mismatch, retrying download", "url", url, "want", etag, "got", got)
+		pr.add(-size)
+	}
+}
+
+// downloadTmp downloads url into tmp, resuming from its current size.
+//
+// Returns the hex encoded hash of the whole content, as selected by
+// newBlobHash.
+func (c *Client) downloadTmp(ctx context.Context, url, tmp, etag string, probeXet bool, size int64, pr *fileProgress) (string, error) {
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR, 0o666)
+	if err != nil {
+		return "", err
+	}
+	h := newBlobHash(etag, size)
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err == nil && offset > size {
+		// The partial file is larger than the expected content, it cannot be
+		// trusted.
+		slog.Warn("hf", "message", "discarding partial download", "file", tmp, "offset", offset, "size", size)
+		offset, err = restartFile(f)
+	}
+	if err == nil && offset != 0 {
+		// Hash the content already present. It is resumed over HTTP even if the
+		// file is stored on Xet.
+		_, err = io.Copy(h, io.NewSectionReader(f, 0, offset))
+		probeXet = false
+	}
+	if err == nil && offset < size && c.Connections > 1 && size-offset > c.chunkSize() {
+		if err = c.downloadRanges(ctx, f, url, etag, offset, size, probeXet, pr); err == nil {
+			_, err = io.Copy(h, io.NewSectionReader(f, offset, size-offset))
+			offset = size
+		} else if errors.Is(err, errRangeUnsupported) {
+			// Fall back to a single stream from where the hash is. The chunks
+			// already written are discarded.
+			slog.Warn("hf", "message", "parallel download not supported", "url", url, "err", err)
+			err = f.Truncate(offset)
+		}
+	}
+	if err == nil && offset < size {
+		err = c.resumeDownload(ctx, f, url, etag, offset, probeXet, h, pr)
+	}
+	if err == nil {
+		// Make sure the content is on disk before the file is renamed into place.
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		var xerr *xetAvailableError
+		if errors.As(err, &xerr) {
+			// The file is empty.
+			_ = os.Remove(tmp)
+		}
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resumeDownload fetches url and appends it to f, starting at offset.
+//
+// It falls back to a full download when the server ignores the Range request
+// or when the etag changed. The content written is also written to h, which
+// is reset on restart.
+func (c *Client) resumeDownload(ctx context.Context, f *os.File, url, etag string, offset int64, probeXet bool, h hash.Hash, pr *fileProgress) error {
+	var hdr map[string]string
+	if offset != 0 {
+		hdr = map[string]string{"Range": fmt.Sprintf("bytes=%d-", offset)}
+	}
+	resp, err := c.request(ctx, c.h, "GET", url, hdr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if probeXet {
+		if err = xetAvailable(resp); err != nil {
+			return err
+		}
+	}
+	if offset != 0 {
+		if e := hubEtag(resp); e != "" && e != etag {
+			// The partial content belongs to another version of the file.
+			slog.Warn("hf", "message", "etag changed, restarting download", "url", url, "want", etag, "got", e)
+			if _, err = restartFile(f); err != nil {
+				return err
+			}
+			h.Reset()
+			_ = resp.Body.Close()
+			return c.resumeDownload(ctx, f, url, etag, 0, false, h, pr)
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			// The server ignored the Range request and is sending the whole
+			// content.
+			slog.Warn("hf", "message", "range ignored, restarting download", "url", url)
+			if offset, err = restartFile(f); err != nil {
+				return err
+			}
+			h.Reset()
+		case resp.StatusCode != http.StatusPartialContent || !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+			slog.Warn("hf", "message", "unexpected range response, restarting download", "url", url, "status", resp.Status, "range", resp.Header.Get("Content-Range"))
+			if _, err = restartFile(f); err != nil {
+				return err
+			}
+			h.Reset()
+			_ = resp.Body.Close()
+			return c.resumeDownload(ctx, f, url, etag, 0, false, h, pr)
+		default:
+			slog.Info("hf", "message", "resuming download", "url", url, "offset", offset)
+		}
+	}
+	pr.add(offset)
+	w := io.MultiWriter(f, h, pr)
+	_, err = io.Copy(w, c.throttle(ctx, resp.Body))
+	return err
+}
+
+// errRangeUnsupported is returned by downloadRanges when the server doesn't
+// honor Range requests.
+var errRangeUnsupported = errors.New("range request not honored")
+
+// downloadRanges fetches the bytes [offset, size) of url concurrently in
+// chunks of c.ChunkSize over c.Connections connections, writing each chunk at
+// its position in f.
+//
+// The first chunk is requested before any other to confirm the server
+// supports Range requests. errRangeUnsupported is returned if not, or if a
+// later chunk is refused.
+//
+// On failure, f is truncated to the longest contiguous prefix fully written so
+// the download can be resumed, and the progress reported is reverted.
+func (c *Client) downloadRanges(ctx context.Context, f *os.File, url, etag string, offset, size int64, probeXet bool, pr *fileProgress) error {
+	chunkSize := c.chunkSize()
+	var chunks [][2]int64
+	for start := offset; start < size; start += chunkSize {
+		chunks = append(chunks, [2]int64{start, min(start+chunkSize, size)})
+	}
+	resp, err := c.rangeRequest(ctx, url, etag, chunks[0][0], chunks[0][1])
+	if err != nil {
+		return err
+	}
+	if probeXet {
+		if err = xetAvailable(resp); err != nil {
+			_ = resp.Body.Close()
+			return err
+		}
+	}
+	pr.add(offset)
+	done := make([]bool, len(chunks))
+	written := make([]int64, len(chunks))
+	eg, ctx2 := errgroup.WithContext(ctx)
+	eg.SetLimit(c.Connections)
+	for i, chunk := range chunks {
+		eg.Go(func() error {
+			r := resp
+			if i != 0 {
+				var err2 error
+				if r, err2 = c.rangeRequest(ctx2, url, etag, chunk[0], chunk[1]); err2 != nil {
+					return err2
+				}
+			}
+			defer r.Body.Close()
+			w := io.MultiWriter(io.NewOffsetWriter(f, chunk[0]), pr)
+			n, err2 := io.Copy(w, io.LimitReader(c.throttle(ctx2, r.Body), chunk[1]-chunk[0]))
+			if err2 == nil && n != chunk[1]-chunk[0] {
+				err2 = io.ErrUnexpectedEOF
+			}
+			// Each goroutine writes to its own index.
+			done[i] = err2 == nil
+			written[i] = n
+			return err2
+		})
+	}
+	if err = eg.Wait(); err != nil {
+		// Keep only the data that can be resumed from.
+		end := offset
+		for i := 0; i < len(chunks) && done[i]; i++ {
+			end = chunks[i][1]
+		}
+		if err2 := f.Truncate(end); err2 != nil {
+			slog.Warn("hf", "message", "failed to truncate partial download", "err", err2)
+		}
+		// The caller reports again what it keeps.
+		total := offset
+		for _, n := range written {
+			total += n
+		}
+		pr.add(-total)
+	}
+	return err
+}
+
+// chunkSize returns c.ChunkSize, or its default when it is not valid.
+func (c *Client) chunkSize() int64 {
+	if c.ChunkSize <= 0 {
+		return defaultChunkSize
+	}
+	return c.ChunkSize
+}
+
+// rangeRequest requests the bytes [start, end) of url.
+//
+// Returns errRangeUnsupported if the server ignored the Range request or if
+// the etag is not the one expected.
+func (c *Client) rangeRequest(ctx context.Context, url, etag string, start, end int64) (*http.Response, error) {
+	hdr := map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", start, end-1)}
+	resp, err := c.request(ctx, c.h, "GET", url, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if e := hubEtag(resp); e != "" && e != etag {
+		err = fmt.Errorf("%w: etag changed from %q to %q", errRangeUnsupported, etag, e)
+	} else if resp.StatusCode != http.StatusPartialContent {
+		err = fmt.Errorf("%w: status %s", errRangeUnsupported, resp.Status)
+	} else if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-%d/", start, end-1)) {
+		err = fmt.Errorf("%w: unexpected Content-Range %q", errRangeUnsupported, cr)
+	}
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// restartFile truncates f so the download can start from scratch.
+//
+// It must be followed by a reset of the hash.
+func restartFile(f *os.File) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return f.Seek(0, io.SeekStart)
+}
+
+// hubEtag returns the etag reported by the Hub for the response.
+//
+// The response is usually the result of a redirect to a CDN, so it walks back
+// the redirect chain up to the Hub's response. Returns an empty string if no
+// Hub response is found.
+func hubEtag(resp *http.Response) string {
+	if h := hubHeader(resp); h != nil {
+		return parseEtag(h)
+	}
+	return ""
+}
+
+// hubHeader returns the headers of the Hub's response in the redirect chain of
+// resp, or nil.
+func hubHeader(resp *http.Response) http.Header {
+	for r := resp; r != nil; r = r.Request.Response {
+		if r.Header.Get("X-Repo-Commit") != "" {
+			return r.Header
+		}
+		if r.Request == nil {
+			break
+		}
+	}
+	return nil
+}
+
+// xetAvailableError is returned by downloadBlob when it was asked to probe for
+// Xet and the file is stored on Xet. Nothing was downloaded.
+type xetAvailableError struct {
+	// h is the headers of the Hub's response, to be parsed with parseXetFile.
+	h http.Header
+}
+
+func (e *xetAvailableError) Error() string {
+	return "file is stored on xet"
+}
+
+// xetAvailable returns a *xetAvailableError if the Hub's response to the
+// download request advertises a Xet hash.
+func xetAvailable(resp *http.Response) error {
+	if h := hubHeader(resp); h != nil && reSHA256.MatchString(h.Get("X-Xet-Hash")) {
+		return &xetAvailableError{h: h}
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const fakeCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// fakeHub is a minimal Hub serving a single model repository.
+//
+// The files ending with ".json" are stored in git, the others in LFS.
+type fakeHub struct {
+	t     testing.TB
+	ref   RepoRef
+	repo  string
+	files map[string][]byte
+	// ignoreRange makes the server always send the whole content.
+	ignoreRange bool
+	// corrupt is the number of GET requests that will return corrupted content.
+	corrupt int
+	// noBlobs makes the repository information omit the files metadata.
+	noBlobs bool
+	// headers is called to alter the headers of a resolve response.
+	headers func(name string, h http.Header)
+	// xet is the Xet hash of the files stored on Xet, which are served by the
+	// CAS server at casURL.
+	xet    map[string]string
+	casURL string
+
+	mu     sync.Mutex
+	ranges []string
+	heads  int
+	// revisions is the number of repository information requests.
+	revisions int
+}
+
+func (f *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Any revision resolves to fakeCommit.
+	if strings.HasPrefix(r.URL.Path, "/api/"+f.ref.apiPath()+"/"+f.repo+"/revision/") {
+		f.mu.Lock()
+		f.revisions++
+		f.mu.Unlock()
+		var siblings []map[string]any
+		for name, content := range f.files {
+			s := map[string]any{"rfilename": name}
+			if !f.noBlobs && r.URL.Query().Get("blobs") == "true" {
+				s["size"] = len(content)
+				if strings.HasSuffix(name, ".json") {
+					s["blobId"] = gitBlobID(content)
+				} else {
+					h := sha256.Sum256(content)
+					s["blobId"] = gitBlobID([]byte("pointer"))
+					s["lfs"] = map[string]any{"sha256": hex.EncodeToString(h[:]), "size": len(content), "pointerSize": 134}
+					if x := f.xet[name]; x != "" {
+						s["xetHash"] = x
+					}
+				}
+			}
+			siblings = append(siblings, s)
+		}
+		b, _ := json.Marshal(map[string]any{"id": f.repo, "sha": fakeCommit, "siblings": siblings})
+		_, _ = w.Write(b)
+		return
+	}
+	if r.URL.Path == "/api/"+f.ref.apiPath()+"/"+f.repo+"/xet-read-token/"+fakeCommit {
+		_ = json.NewEncoder(w).Encode(map[string]any{"casUrl": f.casURL, "accessToken": "xet_token", "exp": time.Now().Add(time.Hour).Unix()})
+		return
+	}
+	name, ok := strings.CutPrefix(r.URL.Path, "/"+f.ref.urlPrefix()+f.repo+"/resolve/"+fakeCommit+"/")
+	if !ok {
+		f.t.Errorf("unexpected path %s", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h := sha256.Sum256(content)
+	if r.Method == "HEAD" {
+		f.mu.Lock()
+		f.heads++
+		f.mu.Unlock()
+	}
+	if r.Method == "GET" {
+		f.mu.Lock()
+		f.ranges = append(f.ranges, r.Header.Get("Range"))
+		if f.corrupt > 0 {
+			f.corrupt--
+			content = bytes.Clone(content)
+			content[len(content)/2] ^= 0xFF
+		}
+		f.mu.Unlock()
+	}
+	w.Header().Set("X-Repo-Commit", fakeCommit)
+	if strings.HasSuffix(name, ".json") {
+		w.Header().Set("Etag", "\""+gitBlobID(content)+"\"")
+	} else {
+		w.Header().Set("X-Linked-Etag", "\""+hex.EncodeToString(h[:])+"\"")
+	}
+	if x := f.xet[name]; x != "" {
+		w.Header().Set("X-Xet-Hash", x)
+	}
+	if f.headers != nil {
+		f.headers(name, w.Header())
+	}
+	if f.ignoreRange {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// gitBlobID returns the git object ID of a blob.
+func gitBlobID(content []byte) string {
+	h := sha1.Sum(append([]byte(fmt.Sprintf("blob %d\x00", len(content))), content...))
+	return hex.EncodeToString(h[:])
+}
+
+// newFakeHub returns a fake Hub serving the model "author/repo".
+func newFakeHub(t testing.TB, files map[string][]byte) (*fakeHub, *Client) {
+	return newFakeHubRepo(t, RepoRef{Author: "author", Repo: "repo"}, files)
+}
+
+func newFakeHubRepo(t testing.TB, ref RepoRef, files map[string][]byte) (*fakeHub, *Client) {
+	f := &fakeHub{t: t, ref: ref, repo: ref.RepoID(), files: files}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, c
+}
+
+func TestEnsureFile_Resume(t *testing.T) {
+	for _, ignoreRange := range []bool{false, true} {
+		t.Run(map[bool]string{false: "range", true: "ignore_range"}[ignoreRange], func(t *testing.T) {
+			content := bytes.Repeat([]byte("0123456789"), 1000)
+			f, c := newFakeHub(t, map[string][]byte{"model.bin": content})
+			f.ignoreRange = ignoreRange
+			ctx := context.Background()
+			ref := ModelRef{Author: "author", Repo: "repo"}
+			_, etag, _, err := c.GetFileInfo(ctx, ref, fakeCommit, "model.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			mdlDir, err := c.prepareModelCache(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Simulate an interrupted download.
+			blob := filepath.Join(mdlDir, "blobs", etag)
+			if err = os.WriteFile(blob+".incomplete", content[:1234], 0o666); err != nil {
+				t.Fatal(err)
+			}
+			f.ranges = nil
+			p, err := c.EnsureFile(ctx, ref, "main", "model.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatal("content mismatch")
+			}
+			if len(f.ranges) != 1 || f.ranges[0] != "bytes=1234-" {
+				t.Fatalf("unexpected ranges %q", f.ranges)
+			}
+			if _, err = os.Stat(blob + ".incomplete"); !os.IsNotExist(err) {
+				t.Fatalf("expected the partial file to be gone: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnsureFile_Parallel(t *testing.T) {
+	for _, ignoreRange := range []bool{false, true} {
+		t.Run(map[bool]string{false: "range", true: "ignore_range"}[ignoreRange], func(t *testing.T) {
+			content := make([]byte, 10000)
+			for i := range content {
+				content[i] = byte(i * 7)
+			}
+			f, c := newFakeHub(t, map[string][]byte{"model.bin": content})
+			f.ignoreRange = ignoreRange
+			c.Connections = 3
+			c.ChunkSize = 1000
+			ref := ModelRef{Author: "author", Repo: "repo"}
+			p, err := c.EnsureFile(context.Background(), ref, "main", "model.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, content) {
+				t.Fatalf("content mismatch: %v", err)
+			}
+			want := 10
+			if ignoreRange {
+				// The first Range request is ignored, then it falls back to a single
+				// request.
+				want = 2
+			}
+			if len(f.ranges) != want {
+				t.Fatalf("unexpected ranges %q", f.ranges)
+			}
+		})
+	}
+}
+
+func TestEnsureFile_ParallelFallback(t *testing.T) {
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	f, c := newFakeHub(t, map[string][]byte{"model.bin": content})
+	// The etag changes after the first Range request, so a later chunk is
+	// refused.
+	var calls atomic.Int32
+	f.headers = func(name string, h http.Header) {
+		if calls.Add(1) > 2 {
+			h.Set("X-Linked-Etag", "\""+strings.Repeat("f", 64)+"\"")
+		}
+	}
+	r := &recordProgress{progress: map[string]int64{}}
+	c.Progress = r
+	c.Connections = 3
+	c.ChunkSize = 1000
+	p, err := c.EnsureFile(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", "model.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	// The bytes received before the fallback are not counted twice.
+	if got := r.progress["model.bin"]; got != int64(len(content)) {
+		t.Fatalf("unexpected progress %d", got)
+	}
+}
+
+func TestEnsureFile_ParallelChunkSize(t *testing.T) {
+	f, c := newFakeHub(t, map[string][]byte{"model.bin": bytes.Repeat([]byte("a"), 1000)})
+	c.Connections = 3
+	// An invalid chunk size uses the default, which is larger than the file.
+	c.ChunkSize = 0
+	if _, err := c.EnsureFile(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", "model.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.ranges) != 1 {
+		t.Fatalf("unexpected ranges %q", f.ranges)
+	}
+}
+
+func TestEnsureFile_Corrupted(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	f, c := newFakeHub(t, map[string][]byte{"model.bin": content})
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+
+	// The first download is corrupted, the retry succeeds.
+	f.corrupt = 1
+	p, err := c.EnsureFile(ctx, ref, "main", "model.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+
+	// All the downloads are corrupted.
+	if err = os.RemoveAll(c.hubCacheDir); err != nil {
+		t.Fatal(err)
+	}
+	f.corrupt = maxDownloadAttempts
+	_, err = c.EnsureFile(ctx, ref, "main", "model.bin")
+	var cerr *CorruptedError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected CorruptedError, got %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(c.hubCacheDir, "models--author--repo", "blobs", "*"))
+	if len(matches) != 0 {
+		t.Fatalf("expected no blob, got %q", matches)
+	}
+}
+
+func TestEnsureFile_DanglingSymlink(t *testing.T) {
+	content := []byte("{}")
+	_, c := newFakeHub(t, map[string][]byte{"config.json": content})
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	p, err := c.EnsureFile(ctx, ref, "main", "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a blob lost from the cache; the existing symlink is replaced.
+	blob, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(blob); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = c.EnsureFile(ctx, ref, "main", "config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(p), "*.tmp"))
+	if len(matches) != 0 {
+		t.Fatalf("unexpected temporary files %q", matches)
+	}
+}
+
+func TestEnsureFile_CommitHash(t *testing.T) {
+	f, c := newFakeHub(t, map[string][]byte{"config.json": []byte("{}")})
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	for i := 0; i < 2; i++ {
+		if _, err := c.EnsureFile(ctx, ref, fakeCommit, "config.json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The snapshot of the commit was found in the cache the second time.
+	if f.revisions != 1 {
+		t.Fatalf("want 1 repository information request, got %d", f.revisions)
+	}
+}
+
+func TestEnsureSnapshot(t *testing.T) {
+	for _, noBlobs := range []bool{false, true} {
+		t.Run(map[bool]string{false: "blobs", true: "no_blobs"}[noBlobs], func(t *testing.T) {
+			files := map[string][]byte{
+				"config.json":         []byte("{}"),
+				"dir/model.bin":       bytes.Repeat([]byte("a"), 4096),
+				"tokenizer.json":      []byte("{\"a\":1}"),
+				"ignored.safetensors": []byte("nope"),
+			}
+			f, c := newFakeHub(t, files)
+			f.noBlobs = noBlobs
+			ref := ModelRef{Author: "author", Repo: "repo"}
+			got, err := c.EnsureSnapshot(context.Background(), ref, "main", []string{"*.json", "dir/*"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 3 {
+				t.Fatalf("unexpected files %q", got)
+			}
+			for _, p := range got {
+				b, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rel, _ := filepath.Rel(filepath.Join(c.hubCacheDir, "models--author--repo", "snapshots", fakeCommit), p)
+				if !bytes.Equal(b, files[filepath.ToSlash(rel)]) {
+					t.Fatalf("content mismatch for %s", rel)
+				}
+			}
+			// The files metadata saves a HEAD request per file.
+			want := 0
+			if noBlobs {
+				want = 3
+			}
+			if f.heads != want {
+				t.Fatalf("want %d HEAD requests, got %d", want, f.heads)
+			}
+		})
+	}
+}
+
+func TestEnsureSnapshot_Concurrent(t *testing.T) {
+	files := map[string][]byte{
+		"a.bin": bytes.Repeat([]byte("a"), 100000),
+		"b.bin": bytes.Repeat([]byte("b"), 100000),
+	}
+	f, c := newFakeHub(t, files)
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	// Two clients share the same cache, like two processes would.
+	c2 := *c
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, cl := range []*Client{c, &c2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = cl.EnsureSnapshot(context.Background(), ref, "main", nil)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each blob was downloaded only once.
+	if len(f.ranges) != len(files) {
+		t.Fatalf("unexpected downloads %q", f.ranges)
+	}
+}
+
+func TestNewBlobHash(t *testing.T) {
+	// Same as "echo 'hello world' | git hash-object --stdin".
+	const want = "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+	content := []byte("hello world\n")
+	h := newBlobHash(want, int64(len(content)))
+	_, _ = h.Write([]byte("garbage"))
+	h.Reset()
+	_, _ = h.Write(content)
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Fatal(got)
+	}
+	s := sha256.Sum256(content)
+	h = newBlobHash(hex.EncodeToString(s[:]), int64(len(content)))
+	_, _ = h.Write(content)
+	if got := h.Sum(nil); !bytes.Equal(got, s[:]) {
+		t.Fatalf("%x", got)
+	}
+}
+
+func TestEnsureFile_GitBlob(t *testing.T) {
+	content := []byte("{\"model_type\": \"llama\"}")
+	f, c := newFakeHub(t, map[string][]byte{"config.json": content})
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	_, etag, size, err := c.GetFileInfo(ctx, ref, fakeCommit, "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != gitBlobID(content) || size != int64(len(content)) {
+		t.Fatal(etag, size)
+	}
+
+	// The first download is corrupted, the retry succeeds.
+	f.corrupt = 1
+	p, err := c.EnsureFile(ctx, ref, "main", "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	// The blob is named after the git blob SHA-1, like the python client does.
+	blob, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(blob) != etag {
+		t.Fatal(blob)
+	}
+
+	// All the downloads are corrupted.
+	if err = os.RemoveAll(c.hubCacheDir); err != nil {
+		t.Fatal(err)
+	}
+	f.corrupt = maxDownloadAttempts
+	var cerr *CorruptedError
+	if _, err = c.EnsureFile(ctx, ref, "main", "config.json"); !errors.As(err, &cerr) {
+		t.Fatalf("expected CorruptedError, got %v", err)
+	}
+}
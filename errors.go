@@ -0,0 +1,151 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Errors reported by the Hub. Use errors.Is to check for them and errors.As
+// with a *HubError to get the details.
+var (
+	// ErrRepoNotFound is returned when the repository doesn't exist or is
+	// private and the token doesn't have access to it.
+	ErrRepoNotFound = errors.New("repository not found")
+	// ErrRevisionNotFound is returned when the branch, tag or commit doesn't
+	// exist.
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrEntryNotFound is returned when the file doesn't exist at the revision.
+	ErrEntryNotFound = errors.New("entry not found")
+	// ErrGatedRepo is returned when the repository is gated and the user has
+	// not been granted access yet. HubError.AccessURL is the page to request
+	// access.
+	ErrGatedRepo = errors.New("repository is gated")
+	// ErrDisabledRepo is returned when the repository was disabled by its
+	// owner or by the Hub's staff.
+	ErrDisabledRepo = errors.New("repository is disabled")
+	// ErrConflict is returned when the name is already taken, e.g. when
+	// creating or moving a repository.
+	ErrConflict = errors.New("name already taken")
+)
+
+// HubError is an error reported by the Hub with the X-Error-Code header, or
+// a conflict.
+type HubError struct {
+	// URL is the URL requested.
+	URL string
+	// StatusCode is the HTTP status code.
+	StatusCode int
+	// Code is the value of the X-Error-Code header, e.g. "GatedRepo".
+	Code string
+	// Message is the value of the X-Error-Message header, or the error in the
+	// response body.
+	Message string
+	// AccessURL is the page where access can be requested when the repository
+	// is gated.
+	AccessURL string
+}
+
+func (e *HubError) Error() string {
+	msg := "request " + e.URL + ": " + http.StatusText(e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.AccessURL != "" {
+		msg += "; request access at " + e.AccessURL
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error matching Code, if any.
+func (e *HubError) Unwrap() error {
+	switch e.Code {
+	case "RepoNotFound":
+		return ErrRepoNotFound
+	case "RevisionNotFound":
+		return ErrRevisionNotFound
+	case "EntryNotFound":
+		return ErrEntryNotFound
+	case "GatedRepo":
+		return ErrGatedRepo
+	case "DisabledRepo":
+		return ErrDisabledRepo
+	}
+	if e.StatusCode == http.StatusConflict {
+		return ErrConflict
+	}
+	return nil
+}
+
+// parseHubError returns a *HubError if the response has the X-Error-Code
+// header or is a conflict, nil otherwise.
+//
+// body is the beginning of the response body, which may contain the error
+// message as JSON.
+func parseHubError(resp *http.Response, body []byte) *HubError {
+	code := resp.Header.Get("X-Error-Code")
+	if code == "" && resp.StatusCode != http.StatusConflict {
+		return nil
+	}
+	e := &HubError{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Code:       code,
+		Message:    resp.Header.Get("X-Error-Message"),
+	}
+	if e.Message == "" {
+		var r struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &r) == nil {
+			e.Message = r.Error
+		}
+	}
+	if code == "GatedRepo" {
+		e.AccessURL = repoPageURL(resp.Request.URL)
+	}
+	return e
+}
+
+// repoPageURL returns the URL of the repository's page from the URL of an API
+// or file request on it.
+//
+// It supports the forms /api/{type}s/{id}/..., /{id}/resolve/... and
+// /{type}s/{id}/resolve/... Returns an empty string otherwise.
+func repoPageURL(u *url.URL) string {
+	parts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	api := len(parts) != 0 && parts[0] == "api"
+	if api {
+		parts = parts[1:]
+	}
+	prefix := ""
+	if len(parts) != 0 {
+		switch parts[0] {
+		case "models":
+			if !api {
+				break
+			}
+			parts = parts[1:]
+		case "datasets", "spaces":
+			prefix = parts[0] + "/"
+			parts = parts[1:]
+		default:
+			if api {
+				return ""
+			}
+		}
+	}
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/" + prefix + parts[0] + "/" + parts[1]
+}
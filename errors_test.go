@@ -0,0 +1,92 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHubError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/a/gated/revision/main":
+			w.Write([]byte(`{"id":"a/gated","sha":"` + fakeCommit + `","gated":"auto","siblings":[{"rfilename":"model.bin"}]}`))
+		case "/a/gated/resolve/" + fakeCommit + "/model.bin":
+			w.Header().Set("X-Error-Code", "GatedRepo")
+			w.Header().Set("X-Error-Message", "Access to model a/gated is restricted and you are not in the authorized list.")
+			w.WriteHeader(http.StatusForbidden)
+		case "/api/models/a/missing/revision/main":
+			w.Header().Set("X-Error-Code", "RepoNotFound")
+			w.Header().Set("X-Error-Message", "Repository not found")
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/api/models/a/gated/revision/nope":
+			w.Header().Set("X-Error-Code", "RevisionNotFound")
+			w.Header().Set("X-Error-Message", "Invalid rev id: nope")
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	m := Model{ModelRef: ModelRef{Author: "a", Repo: "gated"}}
+	if err = c.GetModelInfo(ctx, &m, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Gated != GatedAuto {
+		t.Fatalf("unexpected gated mode %q", m.Gated)
+	}
+	_, err = c.EnsureFile(ctx, m.ModelRef, "main", "model.bin")
+	if !errors.Is(err, ErrGatedRepo) {
+		t.Fatalf("expected ErrGatedRepo, got %v", err)
+	}
+	var herr *HubError
+	if !errors.As(err, &herr) || herr.AccessURL != server.URL+"/a/gated" || herr.StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected error %#v", herr)
+	}
+
+	err = c.GetModelInfo(ctx, &Model{ModelRef: ModelRef{Author: "a", Repo: "missing"}}, "main")
+	if !errors.Is(err, ErrRepoNotFound) {
+		t.Fatalf("expected ErrRepoNotFound, got %v", err)
+	}
+	_, err = c.EnsureSnapshot(ctx, m.ModelRef, "nope", nil)
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("expected ErrRevisionNotFound, got %v", err)
+	}
+}
+
+func TestRepoPageURL(t *testing.T) {
+	data := []struct {
+		in   string
+		want string
+	}{
+		{"https://huggingface.co/api/models/a/b/revision/main", "https://huggingface.co/a/b"},
+		{"https://huggingface.co/api/datasets/a/b/tree/main", "https://huggingface.co/datasets/a/b"},
+		{"https://huggingface.co/a/b/resolve/main/config.json", "https://huggingface.co/a/b"},
+		{"https://huggingface.co/spaces/a/b/resolve/main/app.py", "https://huggingface.co/spaces/a/b"},
+		{"https://huggingface.co/api/whoami-v2", ""},
+		{"https://huggingface.co/a", ""},
+	}
+	for _, l := range data {
+		u, err := url.Parse(l.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := repoPageURL(u); got != l.want {
+			t.Errorf("%s: want %q, got %q", l.in, l.want, got)
+		}
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -23,12 +25,25 @@ import (
 	"time"
 
 	"github.com/maruel/safetensors"
-	"github.com/schollz/progressbar/v3"
 	"golang.org/x/sync/errgroup"
 )
 
-// ModelRef is a reference to a model stored on https://huggingface.co
-type ModelRef struct {
+// RepoType is the type of a repository on the Hub.
+type RepoType string
+
+const (
+	// ModelType is a model repository. It is the default when empty.
+	ModelType RepoType = "model"
+	// DatasetType is a dataset repository.
+	DatasetType RepoType = "dataset"
+	// SpaceType is a Space application repository.
+	SpaceType RepoType = "space"
+)
+
+// RepoRef is a reference to a repository stored on https://huggingface.co
+type RepoRef struct {
+	// Type is the type of the repository. Defaults to ModelType when empty.
+	Type RepoType `json:",omitempty"`
 	// Author is the owner, either a person or an organization.
 	Author string
 	// Repo is the name of the repository owned by the Author.
@@ -37,14 +52,39 @@ type ModelRef struct {
 	_ struct{}
 }
 
+// ModelRef is a reference to a model stored on https://huggingface.co
+//
+// It is a RepoRef with an empty Type.
+type ModelRef = RepoRef
+
 // RepoID is a shorthand to return .m.Author + "/" + m.Repo
-func (m *ModelRef) RepoID() string {
+func (m *RepoRef) RepoID() string {
 	return m.Author + "/" + m.Repo
 }
 
-// URL returns the Model's canonical URL.
-func (m *ModelRef) URL() string {
-	return "https://huggingface.co/" + m.RepoID()
+// URL returns the repository's canonical URL.
+//
+// It honors the environment variable HF_ENDPOINT but not WithEndpoint, use
+// Client.RepoURL for this.
+func (m *RepoRef) URL() string {
+	return defaultEndpoint() + "/" + m.urlPrefix() + m.RepoID()
+}
+
+// urlPrefix returns the prefix of the repository's path in URLs, e.g.
+// "datasets/". It is empty for models.
+func (m *RepoRef) urlPrefix() string {
+	if t := m.Type; t != "" && t != ModelType {
+		return string(t) + "s/"
+	}
+	return ""
+}
+
+// apiPath returns the collection of the repository in the API, e.g. "models".
+func (m *RepoRef) apiPath() string {
+	if m.Type == "" {
+		return "models"
+	}
+	return string(m.Type) + "s"
 }
 
 // Model is a model stored on https://huggingface.co
@@ -70,8 +110,27 @@ type Model struct {
 	License string
 	// LicenseURL is the URL to the license file.
 	LicenseURL string
+	// Tags is the list of tags of the model.
+	Tags []string
+	// PipelineTag is the task of the model, e.g. "text-generation".
+	PipelineTag string
+	// Library is the library to use the model, e.g. "transformers".
+	Library string
+	// Downloads is the number of downloads in the last 30 days.
+	Downloads int64
+	// Likes is the number of likes.
+	Likes int64
+	// Gated is the access request mode of the repository.
+	Gated GatedMode
+	// Private is true when the repository is only visible to its owner.
+	Private bool
+	// Disabled is true when the repository was disabled and its files cannot
+	// be downloaded.
+	Disabled bool
 	// Files is the list of files in the repository.
 	Files []string
+	// FileInfos is the metadata of each file in Files, in the same order.
+	FileInfos []FileInfo
 	// Created is the time the repository was created. It can be at the earliest
 	// 2022-03-02 as documented at
 	// https://huggingface.co/docs/hub/api#repo-listing-api.
@@ -84,23 +143,110 @@ type Model struct {
 	_ struct{}
 }
 
+// GatedMode is how access requests to a gated repository are reviewed.
+//
+// See https://huggingface.co/docs/hub/models-gated
+type GatedMode string
+
+// Valid GatedMode.
+const (
+	// GatedNone means the repository is not gated.
+	GatedNone GatedMode = ""
+	// GatedAuto means access requests are automatically approved.
+	GatedAuto GatedMode = "auto"
+	// GatedManual means access requests are reviewed by the owner.
+	GatedManual GatedMode = "manual"
+)
+
+// parseGated parses the "gated" field of the Hub's API, which is false when
+// the repository is not gated and the mode otherwise.
+func parseGated(v any) GatedMode {
+	switch t := v.(type) {
+	case string:
+		return GatedMode(t)
+	case bool:
+		if t {
+			return GatedAuto
+		}
+	}
+	return GatedNone
+}
+
+// FileInfo is the metadata of a file in a repository.
+type FileInfo struct {
+	// Filename is the path of the file in the repository.
+	Filename string
+	// Size is the size of the file in bytes. For a file stored in LFS, it is the
+	// size of the content, not of the pointer file.
+	Size int64
+	// BlobID is the git object ID of the file.
+	BlobID string
+	// LFS is set when the file is stored in LFS.
+	LFS *LFSInfo
+	// XetHash is set when the file is stored on the Xet backend.
+	XetHash string
+
+	_ struct{}
+}
+
+// defaultChunkSize is the default Client.ChunkSize.
+const defaultChunkSize = 64 * 1024 * 1024
+
 // Client is the client for https://huggingface.co/.
 type Client struct {
-	// serverBase is mocked in test.
+	// Connections is the number of concurrent HTTP Range requests used to
+	// download a single file larger than ChunkSize. Defaults to 1, which
+	// downloads each file over a single connection.
+	//
+	// It must not be modified while a download is in progress.
+	Connections int
+	// ChunkSize is the size of each HTTP Range request when Connections is
+	// larger than 1. Defaults to 64MiB, which is also used when it is 0 or
+	// less.
+	ChunkSize int64
+	// Concurrency is the maximum number of files downloaded concurrently by
+	// EnsureSnapshot. Defaults to 4.
+	Concurrency int
+	// MaxBytesPerSecond limits the aggregate throughput of all the transfers
+	// done by the client, including EnsureFile, each Range request and the LFS
+	// uploads. 0 means unlimited.
+	MaxBytesPerSecond int64
+	// Progress receives the download progress events. Defaults to a progress
+	// bar on stderr. Set to NoProgress{} or nil to disable.
+	Progress ProgressReporter
+	// XetCacheSize is the maximum size in bytes of the cache of chunks
+	// downloaded from Xet, in $HF_HOME/xet/go-chunk-cache. The least recently
+	// used chunks are deleted once it is exceeded. Defaults to 10GiB. 0
+	// disables the cache.
+	XetCacheSize int64
+
 	serverBase string
 	token      string
+	userAgent  string
+	h          *http.Client
 	hubHomeDir string
+	offline    bool
+	// disableXet forces the downloads over plain HTTP even for files stored
+	// on Xet.
+	disableXet bool
 	// Structure is described at https://huggingface.co/docs/huggingface_hub/guides/manage-cache
-	// - .locks/ (not implemented)
-	// - models--*/
+	// - .locks/
+	//   - models--*/, datasets--*/ or spaces--*/
+	//     - <etag>.lock: advisory lock held while downloading the blob.
+	// - models--*/, datasets--*/ or spaces--*/
 	//   - blobs/
-	//     - (sha256 files, not SHA1!)
+	//     - <etag>: sha256 for LFS files, git blob SHA-1 for files stored in
+	//       git, or the Xet hash for Xet files without a sha256 etag.
 	//   - refs/
-	//     - <git ref>: contains hex encoding git commit hash in snapshots/.
+	//     - <git ref>: contains hex encoding git commit hash in snapshots/. It
+	//       can be in a subdirectory, e.g. refs/pr/1.
+	//   - refs@<endpoint>/: like refs/ for an endpoint other than
+	//     https://huggingface.co, e.g. refs@mirror.example.com/.
 	//   - snapshots/
 	//     - <git commit hash>/
 	//       - (symlinks to blobs)
 	hubCacheDir string
+	limiter     *rateLimiter
 }
 
 // New returns a new *Client client to download files and list repositories.
@@ -109,19 +255,36 @@ type Client struct {
 //
 // Respects the following environment variables described at
 // https://huggingface.co/docs/huggingface_hub/package_reference/environment_variables:
-// HF_HOME, HF_HUB_CACHE, HF_TOKEN_PATh and HF_TOKEN.
-func New(token string) (*Client, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+// HF_ENDPOINT, HF_HOME, HF_HUB_CACHE, HF_HUB_DISABLE_XET, HF_HUB_OFFLINE,
+// HF_TOKEN_PATH and HF_TOKEN. Options take precedence over the environment variables.
+//
+// Like the official python client, the blobs and snapshots in the cache are
+// shared across endpoints, so files downloaded from a mirror are visible when
+// using the main Hub and vice versa. The commits that references point to are
+// cached per endpoint, since a mirror may lag behind.
+func New(token string, opts ...Option) (*Client, error) {
+	o := options{h: http.DefaultClient, endpoint: defaultEndpoint(), offline: envBool("HF_HUB_OFFLINE")}
+	for _, opt := range opts {
+		opt(&o)
 	}
-	hubHomeDir := filepath.Join(home, ".cache", "huggingface")
-	if e := os.Getenv("HF_HOME"); e != "" {
-		hubHomeDir = e
+	if o.endpoint != "https://huggingface.co" {
+		slog.Info("hf", "endpoint", o.endpoint)
 	}
-	hubCacheDir := filepath.Join(hubHomeDir, "hub")
-	if e := os.Getenv("HF_HUB_CACHE"); e != "" {
-		hubCacheDir = e
+	hubHomeDir := o.homeDir
+	if hubHomeDir == "" {
+		if hubHomeDir = os.Getenv("HF_HOME"); hubHomeDir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			hubHomeDir = filepath.Join(home, ".cache", "huggingface")
+		}
+	}
+	hubCacheDir := o.cacheDir
+	if hubCacheDir == "" {
+		if hubCacheDir = os.Getenv("HF_HUB_CACHE"); hubCacheDir == "" {
+			hubCacheDir = filepath.Join(hubHomeDir, "hub")
+		}
 	}
 	if err := os.MkdirAll(hubCacheDir, 0o777); err != nil {
 		return nil, err
@@ -131,28 +294,98 @@ func New(token string) (*Client, error) {
 		tokenFile = e
 	}
 
+	saveToken := false
 	if token == "" {
-		if token = os.Getenv("HF_TOKEN"); token == "" {
+		if o.tokenSource != nil {
+			var err error
+			if token, err = o.tokenSource(); err != nil {
+				return nil, fmt.Errorf("failed to get token: %w", err)
+			}
+		} else if token = os.Getenv("HF_TOKEN"); token == "" {
 			if t, err := os.ReadFile(tokenFile); err == nil {
 				token = strings.TrimSpace(string(t))
 				slog.Info("hf", "message", "found token from cache", "file", tokenFile)
 			}
 		}
 	} else if _, err := os.Stat(tokenFile); os.IsNotExist(err) {
-		if err = os.WriteFile(tokenFile, []byte(token), 0o644); err != nil {
+		saveToken = true
+	}
+	if token != "" && !strings.HasPrefix(token, "hf_") {
+		return nil, errors.New("token is invalid, it must have prefix 'hf_'")
+	}
+	c := &Client{
+		Connections:  1,
+		ChunkSize:    defaultChunkSize,
+		Concurrency:  4,
+		Progress:     NewProgressBar(os.Stderr),
+		XetCacheSize: 10 * 1024 * 1024 * 1024,
+		serverBase:   o.endpoint,
+		token:        token,
+		userAgent:    o.userAgent,
+		h:            o.h,
+		offline:      o.offline,
+		disableXet:   envBool("HF_HUB_DISABLE_XET"),
+		hubHomeDir:   hubHomeDir,
+		hubCacheDir:  hubCacheDir,
+		limiter:      &rateLimiter{},
+	}
+	if o.checkToken != nil {
+		u, err := c.WhoAmI(o.checkToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate token: %w", err)
+		}
+		slog.Info("hf", "message", "token validated", "user", u.Name, "token", u.Token.Name, "role", u.Token.Role)
+	}
+	if saveToken {
+		if err := os.WriteFile(tokenFile, []byte(token), 0o644); err != nil {
 			return nil, err
 		}
 		slog.Info("hf", "message", "saved token to cache", "file", tokenFile)
 	}
-	if token != "" && !strings.HasPrefix(token, "hf_") {
-		return nil, errors.New("token is invalid, it must have prefix 'hf_'")
+	return c, nil
+}
+
+// RepoURL returns the repository's canonical URL on the client's endpoint.
+func (c *Client) RepoURL(ref RepoRef) string {
+	return c.serverBase + "/" + ref.urlPrefix() + ref.RepoID()
+}
+
+// refsDir returns the directory caching the commit of each reference of the
+// repository for the client's endpoint.
+//
+// The python client's refs/ is used for https://huggingface.co.
+func (c *Client) refsDir(ref RepoRef) string {
+	name := "refs"
+	if c.serverBase != "https://huggingface.co" {
+		host := c.serverBase
+		if _, after, ok := strings.Cut(host, "://"); ok {
+			host = after
+		}
+		name += "@" + reNotFileSafe.ReplaceAllString(host, "_")
+	}
+	return filepath.Join(c.hubCacheDir, repoFolderName(ref), name)
+}
+
+// reNotFileSafe matches the characters replaced to make a file name.
+var reNotFileSafe = regexp.MustCompile(`[^A-Za-z0-9.\-]`)
+
+// defaultEndpoint returns the Hub's base URL, which can be overridden with the
+// environment variable HF_ENDPOINT to use a mirror.
+func defaultEndpoint() string {
+	if e := strings.TrimRight(os.Getenv("HF_ENDPOINT"), "/"); e != "" {
+		return e
 	}
-	return &Client{
-		serverBase:  "https://huggingface.co",
-		token:       token,
-		hubHomeDir:  hubHomeDir,
-		hubCacheDir: hubCacheDir,
-	}, nil
+	return "https://huggingface.co"
+}
+
+// envBool returns true if the environment variable is set to a true value,
+// like the official python client.
+func envBool(name string) bool {
+	switch strings.ToUpper(os.Getenv(name)) {
+	case "1", "ON", "YES", "TRUE":
+		return true
+	}
+	return false
 }
 
 // https://huggingface.co/docs/hub/api#get-apimodelsrepoid-or-apimodelsrepoidrevisionrevision
@@ -203,6 +436,14 @@ type modelInfoResponse struct {
 	SHA      string `json:"sha"`
 	Siblings []struct {
 		Filename string `json:"rfilename"`
+		BlobID   string `json:"blobId"`
+		Size     int64  `json:"size"`
+		LFS      *struct {
+			SHA256      string `json:"sha256"`
+			Size        int64  `json:"size"`
+			PointerSize int64  `json:"pointerSize"`
+		} `json:"lfs"`
+		XetHash string `json:"xetHash"`
 	}
 	Spaces          []string         `json:"spaces"`
 	Tags            []string         `json:"tags"`
@@ -216,8 +457,8 @@ type modelInfoResponse struct {
 // Use "main" as ref unless you need a specific commit.
 func (c *Client) GetModelInfo(ctx context.Context, m *Model, ref string) error {
 	slog.Info("hf", "model", m.RepoID())
-	url := c.serverBase + "/api/models/" + m.RepoID() + "/revision/" + ref
-	resp, err := AuthRequest(ctx, http.DefaultClient, "GET", url, c.token, nil)
+	url := c.serverBase + "/api/models/" + m.RepoID() + "/revision/" + escapeRevision(ref) + "?blobs=true"
+	resp, err := c.request(ctx, c.h, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to list repoID %s: %w", m.RepoID(), err)
 	}
@@ -240,6 +481,7 @@ func (c *Client) GetModelInfo(ctx context.Context, m *Model, ref string) error {
 		return fmt.Errorf("failed to parse list repoID %s response: %w", m.RepoID(), err)
 	}
 	m.Files = make([]string, len(r.Siblings))
+	m.FileInfos = make([]FileInfo, len(r.Siblings))
 	m.Created = r.CreatedAt
 	m.Modified = r.LastModified
 	m.SHA = r.SHA
@@ -251,8 +493,20 @@ func (c *Client) GetModelInfo(ctx context.Context, m *Model, ref string) error {
 	}
 	m.License, _ = r.CardData["license"].(string)
 	m.LicenseURL, _ = r.CardData["license_link"].(string)
-	for i := range r.Siblings {
-		m.Files[i] = r.Siblings[i].Filename
+	m.Tags = r.Tags
+	m.PipelineTag = r.PipelineTag
+	m.Library = r.LibraryName
+	m.Downloads = r.Downloads
+	m.Likes = r.Likes
+	m.Gated = parseGated(r.Gated)
+	m.Private = r.Private
+	m.Disabled = r.Disabled
+	for i, f := range r.Siblings {
+		m.Files[i] = f.Filename
+		m.FileInfos[i] = FileInfo{Filename: f.Filename, Size: f.Size, BlobID: f.BlobID, XetHash: f.XetHash}
+		if f.LFS != nil {
+			m.FileInfos[i].LFS = &LFSInfo{SHA256: f.LFS.SHA256, Size: f.LFS.Size, PointerSize: f.LFS.PointerSize}
+		}
 	}
 	for k, s := range r.SafeTensors.Parameters {
 		if s > m.NumWeights {
@@ -274,7 +528,7 @@ var (
 // EnsureFile ensures the file is available, downloads it otherwise.
 //
 // Similar to https://huggingface.co/docs/huggingface_hub/package_reference/file_download
-func (c *Client) EnsureFile(ctx context.Context, ref ModelRef, revision, file string) (string, error) {
+func (c *Client) EnsureFile(ctx context.Context, ref RepoRef, revision, file string) (string, error) {
 	mdlDir, commitish, _, err := c.resolveCommit(ctx, ref, revision)
 	if err != nil {
 		return "", err
@@ -290,19 +544,23 @@ func (c *Client) EnsureFile(ctx context.Context, ref ModelRef, revision, file st
 		slog.Info("hf", "ensure_file", ref, "commit", commitish, "ln", ln)
 		return ln, err
 	}
+	if c.offline {
+		return "", &NotInCacheError{Repo: ref.RepoID(), Revision: revision, File: file}
+	}
 
 	// We have to download it.
-	_, etag, _, err := c.GetFileInfo(ctx, ref, commitish, file)
+	_, etag, size, x, err := c.getFileInfo(ctx, ref, commitish, file)
 	if err != nil {
 		return "", err
 	}
-	blob := filepath.Join(mdlDir, "blobs", etag)
-	url := c.serverBase + "/" + ref.RepoID() + "/resolve/" + commitish + "/" + file + "?download=true"
-	// TODO: filepath.Join(c.hubCacheDir, ".locks", modelPath, etag + ".lock")
-	if err = downloadFile(ctx, url, blob, c.token); err != nil {
+	m := missing{file, snapshotDir, filepath.Join(mdlDir, "blobs", etag), etag, size, x, false}
+	p := c.progress()
+	p.Start(1, size)
+	defer p.Done()
+	if err = c.fetchMissing(ctx, ref, commitish, m, p); err != nil {
 		return "", err
 	}
-	return ln, makeSnapshotSymlink(snapshotDir, file, blob)
+	return ln, nil
 }
 
 type missing struct {
@@ -311,28 +569,73 @@ type missing struct {
 	blob        string
 	etag        string
 	size        int64
+	// xet is set when the file can be downloaded from Xet.
+	xet *xetFile
+	// probeXet is set when it is not known whether the file is stored on Xet,
+	// which the response to the download request tells.
+	probeXet bool
 }
 
-func (c *Client) fetchMissing(ctx context.Context, ref ModelRef, commitish string, m missing, bar io.Writer) error {
-	url := c.serverBase + "/" + ref.RepoID() + "/resolve/" + commitish + "/" + m.name + "?download=true"
-	resp, err := AuthRequest(ctx, http.DefaultClient, "GET", url, c.token, nil)
-	if err != nil {
-		return fmt.Errorf("failed to download %q: %w", m.blob, err)
+// verify returns true if the content can be verified against the etag. It
+// cannot when the etag is a Xet hash, a merkle hash of the BLAKE3 hashes of
+// the chunks. In that case, only the sizes of the chunks, of the terms and of
+// the file are verified.
+func (m *missing) verify() bool {
+	return m.xet == nil || m.etag != m.xet.hash
+}
+
+func (c *Client) fetchMissing(ctx context.Context, ref RepoRef, commitish string, m missing, p ProgressReporter) error {
+	p.FileStart(m.name, m.size)
+	if err := c.fetchMissingImpl(ctx, ref, commitish, m, &fileProgress{p: p, name: m.name}); err != nil {
+		p.FileError(m.name, err)
+		return err
 	}
-	defer resp.Body.Close()
-	// Only then create the file.
-	// TODO: filepath.Join(c.hubCacheDir, ".locks", modelPath, etag + ".lock")
-	f, err := os.OpenFile(m.blob, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o666)
+	p.FileDone(m.name)
+	return nil
+}
+
+func (c *Client) fetchMissingImpl(ctx context.Context, ref RepoRef, commitish string, m missing, pr *fileProgress) error {
+	// Serialize with other processes sharing the same cache.
+	lock, err := acquireLock(ctx, filepath.Join(c.hubCacheDir, ".locks", repoFolderName(ref), m.etag+".lock"))
 	if err != nil {
-		return fmt.Errorf("failed to download %q: %w", m.blob, err)
+		return fmt.Errorf("failed to lock %q: %w", m.name, err)
 	}
-	defer f.Close()
-	if _, err = io.Copy(io.MultiWriter(f, bar), resp.Body); err != nil {
-		return err
+	defer lock.release()
+	// The blob may have been downloaded by another process while waiting for the
+	// lock, or may be referenced by another snapshot.
+	if _, err = os.Stat(m.blob); err == nil {
+		pr.add(m.size)
+	} else {
+		url := c.resolveURL(ref, commitish, m.name)
+		x, probe := m.xet, m.probeXet
+		if c.disableXet {
+			x, probe = nil, false
+		}
+		if x == nil {
+			err = c.downloadBlob(ctx, url, m.blob, m.etag, m.verify(), probe, m.size, pr)
+			if xerr := (*xetAvailableError)(nil); errors.As(err, &xerr) {
+				// Nothing was downloaded yet.
+				x = c.parseXetFile(xerr.h, ref, commitish)
+			}
+		}
+		if x != nil {
+			if err = c.downloadXet(ctx, x, m.blob, m.etag, m.verify(), m.size, pr); err != nil && ctx.Err() == nil {
+				// The resolve URL serves the same content over plain HTTP.
+				slog.Warn("hf", "message", "xet download failed, falling back to HTTP", "file", m.name, "err", err)
+				err = c.downloadBlob(ctx, url, m.blob, m.etag, m.verify(), false, m.size, pr)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to download %q: %w", m.name, err)
+		}
 	}
 	return makeSnapshotSymlink(m.snapshotDir, m.name, m.blob)
 }
 
+// makeSnapshotSymlink creates the symlink snapshotDir/file pointing to blob.
+//
+// The symlink is first created under a temporary name then renamed, so it is
+// atomically created or replaced.
 func makeSnapshotSymlink(snapshotDir, file, blob string) error {
 	ln := filepath.Join(snapshotDir, file)
 	rel, err := filepath.Rel(filepath.Dir(ln), blob)
@@ -344,7 +647,41 @@ func makeSnapshotSymlink(snapshotDir, file, blob string) error {
 			return err
 		}
 	}
-	return os.Symlink(rel, ln)
+	tmp := fmt.Sprintf("%s.%d.%d.tmp", ln, os.Getpid(), rand.Uint32())
+	if err = os.Symlink(rel, tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, ln); err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file then renames it to p.
+//
+// Concurrent readers see either the old content or the new one, never a
+// partial one. The file is created with the usual permissions, as filtered by
+// the umask.
+func writeFileAtomic(p string, data []byte) error {
+	tmp := fmt.Sprintf("%s.%d.%d.tmp", p, os.Getpid(), rand.Uint32())
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
 }
 
 // EnsureSnapshot ensures files available from the snapshot, downloads them otherwise.
@@ -353,7 +690,7 @@ func makeSnapshotSymlink(snapshotDir, file, blob string) error {
 //
 // Similar to
 // https://huggingface.co/docs/huggingface_hub/package_reference/file_download#huggingface_hub.snapshot_download
-func (c *Client) EnsureSnapshot(ctx context.Context, ref ModelRef, revision string, glob []string) ([]string, error) {
+func (c *Client) EnsureSnapshot(ctx context.Context, ref RepoRef, revision string, glob []string) ([]string, error) {
 	for _, g := range glob {
 		if strings.HasPrefix(g, "/") || strings.HasPrefix(g, "\\") || strings.Contains(g, "..") {
 			return nil, fmt.Errorf("refusing glob %q", g)
@@ -363,30 +700,18 @@ func (c *Client) EnsureSnapshot(ctx context.Context, ref ModelRef, revision stri
 	if err != nil {
 		return nil, err
 	}
+	if c.offline {
+		return c.cachedSnapshot(ref, revision, filepath.Join(mdlDir, "snapshots", commitish), glob)
+	}
 	// For now, always do an HTTP request to make sure we know exactly which files we are looking for.
 	if mdlInfo == nil {
-		mdlInfo = &Model{ModelRef: ref}
-		if err = c.GetModelInfo(ctx, mdlInfo, commitish); err != nil {
+		if mdlInfo, err = c.getRepoInfo(ctx, ref, commitish); err != nil {
 			return nil, err
 		}
 	}
-	var desired []string
-	if len(glob) == 0 {
-		desired = mdlInfo.Files
-	} else {
-		for _, f := range mdlInfo.Files {
-			for _, g := range glob {
-				if m, err2 := filepath.Match(g, f); err2 != nil {
-					return nil, fmt.Errorf("glob %q is invalid: %w", g, err2)
-				} else if m {
-					desired = append(desired, f)
-					break
-				}
-			}
-		}
-	}
-	if len(desired) == 0 {
-		return nil, fmt.Errorf("no file matched the globs %q", glob)
+	desired, err := matchGlobs(mdlInfo.files, glob)
+	if err != nil {
+		return nil, err
 	}
 	snapshotDir := filepath.Join(mdlDir, "snapshots", commitish)
 	if err = os.MkdirAll(snapshotDir, 0o777); err != nil {
@@ -399,34 +724,51 @@ func (c *Client) EnsureSnapshot(ctx context.Context, ref ModelRef, revision stri
 	for _, f := range desired {
 		ln := filepath.Join(snapshotDir, f)
 		if _, err = os.Stat(ln); err != nil {
-			// We'll have to download it.
-			_, etag, size, err2 := c.GetFileInfo(ctx, ref, commitish, f)
-			if err2 != nil {
-				return nil, err2
+			// We'll have to download it. Use the metadata from the repository
+			// information when available to save a request per file.
+			var etag string
+			var size int64
+			var x *xetFile
+			probe := false
+			fi := mdlInfo.infos[f]
+			switch {
+			case fi != nil && fi.LFS != nil && reSHA256.MatchString(fi.LFS.SHA256):
+				etag, size = fi.LFS.SHA256, fi.LFS.Size
+				if reSHA256.MatchString(fi.XetHash) {
+					x = &xetFile{hash: fi.XetHash, refreshRoute: c.xetRefreshRoute(ref, commitish)}
+				} else {
+					// Without a Xet hash in the metadata, the download request
+					// tells whether the file is stored on Xet.
+					probe = true
+				}
+			case fi != nil && fi.LFS == nil && reSHA1.MatchString(fi.BlobID):
+				etag, size = fi.BlobID, fi.Size
+			default:
+				var err2 error
+				if _, etag, size, x, err2 = c.getFileInfo(ctx, ref, commitish, f); err2 != nil {
+					return nil, err2
+				}
 			}
 			blob := filepath.Join(mdlDir, "blobs", etag)
-			missings = append(missings, missing{f, snapshotDir, blob, etag, size})
+			missings = append(missings, missing{f, snapshotDir, blob, etag, size, x, probe})
 			total += size
 		}
 		out = append(out, ln)
 	}
 
 	if len(missings) != 0 {
-		title := fmt.Sprintf("downloading (%d)", len(missings))
-		if len(missings) == 1 {
-			title = filepath.Base(missings[0].name)
-		}
-		bar := progressbar.DefaultBytes(total, title)
+		p := c.progress()
+		p.Start(len(missings), total)
+		defer p.Done()
 		eg, ctx2 := errgroup.WithContext(ctx)
-		// Limit for 4 concurrently.
-		limit := make(chan struct{}, 4)
+		limit := make(chan struct{}, max(c.Concurrency, 1))
 		for _, m := range missings {
 			eg.Go(func() error {
 				limit <- struct{}{}
 				defer func() {
 					<-limit
 				}()
-				return c.fetchMissing(ctx2, ref, commitish, m, bar)
+				return c.fetchMissing(ctx2, ref, commitish, m, p)
 			})
 		}
 		if err = eg.Wait(); err != nil {
@@ -436,59 +778,134 @@ func (c *Client) EnsureSnapshot(ctx context.Context, ref ModelRef, revision stri
 	return out, nil
 }
 
+// progress returns the ProgressReporter to use.
+func (c *Client) progress() ProgressReporter {
+	if c.Progress == nil {
+		return NoProgress{}
+	}
+	return c.Progress
+}
+
+// matchGlobs returns the files matching any of the globs. All files are
+// returned if glob is empty.
+func matchGlobs(files, glob []string) ([]string, error) {
+	if len(glob) == 0 {
+		if len(files) == 0 {
+			return nil, errors.New("no file found")
+		}
+		return files, nil
+	}
+	var desired []string
+	for _, f := range files {
+		for _, g := range glob {
+			if m, err := filepath.Match(g, f); err != nil {
+				return nil, fmt.Errorf("glob %q is invalid: %w", g, err)
+			} else if m {
+				desired = append(desired, f)
+				break
+			}
+		}
+	}
+	if len(desired) == 0 {
+		return nil, fmt.Errorf("%w %q", errNoGlobMatch, glob)
+	}
+	return desired, nil
+}
+
+// errNoGlobMatch is returned by matchGlobs when no file matched.
+var errNoGlobMatch = errors.New("no file matched the globs")
+
 // GetFileInfo retrieves the information about the file.
 //
-// Returns the commitish, etag, size.
-func (c *Client) GetFileInfo(ctx context.Context, ref ModelRef, revision, file string) (string, string, int64, error) {
+// Returns the commitish, etag, size. The etag is the sha256 of the content for
+// LFS files and the git blob SHA-1 for files stored in git. For a file stored
+// on Xet whose etag is neither, the etag is the Xet hash of the file.
+func (c *Client) GetFileInfo(ctx context.Context, ref RepoRef, revision, file string) (string, string, int64, error) {
+	commitIsh, etag, size, _, err := c.getFileInfo(ctx, ref, revision, file)
+	return commitIsh, etag, size, err
+}
+
+// getFileInfo is GetFileInfo that also returns the Xet information of the
+// file, which is nil if the file is not stored on Xet.
+func (c *Client) getFileInfo(ctx context.Context, ref RepoRef, revision, file string) (string, string, int64, *xetFile, error) {
 	hdr := map[string]string{"Accept-Encoding": "identity"}
-	url := c.serverBase + "/" + ref.RepoID() + "/resolve/" + revision + "/" + file + "?download=true"
-	// We must disable redirect otherwise we get the invalid headers from CloudFront / AmazonS3.
-	h := http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+	url := c.resolveURL(ref, revision, file)
+	// We must stop at the Hub's response otherwise we get the invalid headers
+	// from CloudFront / AmazonS3. Redirects before that are followed, e.g. a
+	// renamed repository or a mirror redirecting to another host.
+	h := *c.h
+	h.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.Response != nil && req.Response.Header.Get("X-Repo-Commit") != "" {
 			return http.ErrUseLastResponse
-		},
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
 	}
-	resp, err := AuthRequest(ctx, &h, "HEAD", url, c.token, hdr)
+	resp, err := c.request(ctx, &h, "HEAD", url, hdr)
 	if err != nil {
-		return "", "", 0, err
+		return "", "", 0, nil, err
 	}
 	_, _ = io.ReadAll(resp.Body)
 	_ = resp.Body.Close()
 	commitIsh := resp.Header.Get("X-Repo-Commit")
 	if commitIsh == "" {
-		return "", "", 0, errors.New("missing header X-Repo-Commit")
-	}
-	etag := resp.Header.Get("X-Linked-Etag")
-	if etag == "" {
-		etag = resp.Header.Get("Etag")
+		return "", "", 0, nil, errors.New("missing header X-Repo-Commit")
 	}
-	etag = strings.Trim(strings.TrimPrefix(etag, "W/"), "\"")
-	if !reSHA256.MatchString(etag) {
-		return "", "", 0, fmt.Errorf("expected sha256 for etag, got %q", etag)
+	etag := parseEtag(resp.Header)
+	x := c.parseXetFile(resp.Header, ref, commitIsh)
+	if !reSHA256.MatchString(etag) && !reSHA1.MatchString(etag) {
+		if x == nil {
+			return "", "", 0, nil, fmt.Errorf("expected sha256 or git SHA-1 for etag, got %q", etag)
+		}
+		// The blob is named after the Xet hash, like the python client does.
+		etag = x.hash
 	}
 	sizeStr := resp.Header.Get("X-Linked-Size")
 	if sizeStr == "" {
 		sizeStr = resp.Header.Get("Content-Length")
 	}
 	if sizeStr == "" {
-		return "", "", 0, errors.New("missing header X-Linked-Size")
+		return "", "", 0, nil, errors.New("missing header X-Linked-Size")
 	}
 	size, err := strconv.ParseInt(sizeStr, 10, 64)
 	if err != nil {
-		return "", "", 0, fmt.Errorf("invalid header X-Linked-Size %q", sizeStr)
+		return "", "", 0, nil, fmt.Errorf("invalid header X-Linked-Size %q", sizeStr)
 	}
 	// resp.Header.Get("Location") or url
-	slog.Info("hf", "file_info", ref, "commit", commitIsh, "etag", etag, "size", size)
-	return commitIsh, etag, size, nil
+	slog.Info("hf", "file_info", ref, "commit", commitIsh, "etag", etag, "size", size, "xet", x != nil)
+	return commitIsh, etag, size, x, nil
+}
+
+// parseEtag returns the normalized etag from the headers of a Hub response.
+//
+// For LFS files, the header X-Linked-Etag contains the sha256 of the content.
+// For files stored in git, the header Etag contains the git blob SHA-1.
+func parseEtag(h http.Header) string {
+	etag := h.Get("X-Linked-Etag")
+	if etag == "" {
+		etag = h.Get("Etag")
+	}
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), "\"")
+}
+
+// repoFolderName returns the name of the directory for the repository in the
+// cache.
+func repoFolderName(ref RepoRef) string {
+	return ref.apiPath() + "--" + strings.ReplaceAll(ref.RepoID(), "/", "--")
+}
+
+// resolveURL returns the URL to download the file at the revision.
+func (c *Client) resolveURL(ref RepoRef, revision, file string) string {
+	return c.serverBase + "/" + ref.urlPrefix() + ref.RepoID() + "/resolve/" + escapeRevision(revision) + "/" + file + "?download=true"
 }
 
 // prepareModelCache returns the absolute path to store the model's cache.
 //
 // Makes sure blobs/, refs/ and snapshots/ exist.
-func (c *Client) prepareModelCache(ref ModelRef) (string, error) {
-	repoID := ref.RepoID()
-	name := "models--" + strings.ReplaceAll(repoID, "/", "--")
-	mdlDir := filepath.Join(c.hubCacheDir, name)
+func (c *Client) prepareModelCache(ref RepoRef) (string, error) {
+	mdlDir := filepath.Join(c.hubCacheDir, repoFolderName(ref))
 	for _, n := range []string{"blobs", "refs", "snapshots"} {
 		if err := os.MkdirAll(filepath.Join(mdlDir, n), 0o777); err != nil {
 			return "", err
@@ -497,104 +914,224 @@ func (c *Client) prepareModelCache(ref ModelRef) (string, error) {
 	return mdlDir, nil
 }
 
-func (c *Client) resolveCommit(ctx context.Context, ref ModelRef, commitish string) (string, string, *Model, error) {
-	// TODO: Currently hard-coded for models. Add datasets and spaces later.
+// repoInfo is the information needed to download a snapshot of any type of
+// repository.
+type repoInfo struct {
+	sha   string
+	files []string
+	// infos is the metadata of the files, when known.
+	infos map[string]*FileInfo
+}
+
+// getRepoInfo retrieves the commit hash and the list of files of the
+// repository at the revision.
+func (c *Client) getRepoInfo(ctx context.Context, ref RepoRef, revision string) (*repoInfo, error) {
+	switch ref.Type {
+	case "", ModelType:
+		m := Model{ModelRef: ref}
+		if err := c.GetModelInfo(ctx, &m, revision); err != nil {
+			return nil, err
+		}
+		r := &repoInfo{sha: m.SHA, files: m.Files, infos: make(map[string]*FileInfo, len(m.FileInfos))}
+		for i := range m.FileInfos {
+			r.infos[m.FileInfos[i].Filename] = &m.FileInfos[i]
+		}
+		return r, nil
+	case DatasetType:
+		d := Dataset{RepoRef: ref}
+		if err := c.GetDatasetInfo(ctx, &d, revision); err != nil {
+			return nil, err
+		}
+		return &repoInfo{sha: d.SHA, files: d.Files}, nil
+	case SpaceType:
+		s := Space{RepoRef: ref}
+		if err := c.GetSpaceInfo(ctx, &s, revision); err != nil {
+			return nil, err
+		}
+		return &repoInfo{sha: s.SHA, files: s.Files}, nil
+	default:
+		return nil, fmt.Errorf("unsupported repository type %q", ref.Type)
+	}
+}
+
+// resolveCommit returns the repository's cache directory and the commit hash
+// for the revision.
+//
+// The repository information is returned when it had to be fetched.
+func (c *Client) resolveCommit(ctx context.Context, ref RepoRef, commitish string) (string, string, *repoInfo, error) {
 	// See https://huggingface.co/docs/huggingface_hub/guides/manage-cache
 	mdlDir, err := c.prepareModelCache(ref)
 	if err != nil {
 		return "", "", nil, err
 	}
-	cmtPath := filepath.Join(mdlDir, "refs", commitish)
-	var m *Model
+	if err = checkRevision(commitish); err != nil {
+		return "", "", nil, err
+	}
+	// Revisions like "refs/pr/1" are stored in subdirectories, like the python
+	// client does.
+	cmtPath := filepath.Join(c.refsDir(ref), filepath.FromSlash(commitish))
+	var m *repoInfo
 	if b, err := os.ReadFile(cmtPath); err == nil {
 		commitish = string(bytes.TrimSpace(b))
 		if !reSHA1.MatchString(commitish) {
 			return "", "", nil, fmt.Errorf("%s contains %q which is not a commit hash", cmtPath, commitish)
 		}
+	} else if _, err = os.Stat(filepath.Join(mdlDir, "snapshots", commitish)); err == nil && reSHA1.MatchString(commitish) {
+		// A commit hash can be used directly if its snapshot is present, which
+		// saves a request.
+		return mdlDir, commitish, nil, nil
+	} else if c.offline {
+		return "", "", nil, &NotInCacheError{Repo: ref.RepoID(), Revision: commitish}
 	} else {
-		m = &Model{ModelRef: ref}
-		if err = c.GetModelInfo(ctx, m, commitish); err != nil {
+		if m, err = c.getRepoInfo(ctx, ref, commitish); err != nil {
 			return "", "", nil, err
 		}
-		commitish = m.SHA
-		if !reSHA1.MatchString(commitish) {
-			return "", "", nil, fmt.Errorf("%q is not a commit hash", commitish)
+		if !reSHA1.MatchString(m.sha) {
+			return "", "", nil, fmt.Errorf("%q is not a commit hash", m.sha)
 		}
-		if err := os.WriteFile(cmtPath, []byte(m.SHA), 0o666); err != nil {
-			return "", "", nil, err
+		// Like the python client, only save the mapping for named revisions.
+		if commitish != m.sha {
+			if err = os.MkdirAll(filepath.Dir(cmtPath), 0o777); err != nil {
+				return "", "", nil, err
+			}
+			if err := writeFileAtomic(cmtPath, []byte(m.sha)); err != nil {
+				return "", "", nil, err
+			}
 		}
+		commitish = m.sha
 	}
 	return mdlDir, commitish, m, nil
 }
 
+// request calls AuthRequest with the client's token and user agent.
 //
+// It fails with ErrOffline in offline mode.
+func (c *Client) request(ctx context.Context, h *http.Client, method, url string, hdr map[string]string) (*http.Response, error) {
+	return c.requestBody(ctx, h, method, url, hdr, nil)
+}
 
-// downloadFile downloads a file optionally with a bearer token.
+// requestBody calls AuthRequestBody with the client's token and user agent.
 //
-// This is a generic utility function. It retries 429 and 5xx automatically.
+// It fails with ErrOffline in offline mode.
+func (c *Client) requestBody(ctx context.Context, h *http.Client, method, url string, hdr map[string]string, body io.ReadSeeker) (*http.Response, error) {
+	return c.requestToken(ctx, h, method, url, c.token, hdr, body, isIdempotent(method))
+}
+
+// requestToken calls AuthRequestBody with token instead of the client's token,
+// e.g. for a Xet access token or an empty one for presigned URLs.
 //
-// It prints a progress bar if the file is at least 100kiB.
-func downloadFile(ctx context.Context, url, dst string, token string) error {
-	resp, err := AuthRequest(ctx, http.DefaultClient, "GET", url, token, nil)
-	if err != nil {
-		return fmt.Errorf("failed to download %q: %w", dst, err)
-	}
-	defer resp.Body.Close()
-	// Only then create the file.
-	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o666)
-	if err != nil {
-		return fmt.Errorf("failed to download %q: %w", dst, err)
+// 429 and 5xx are retried only when retry is true. It fails with ErrOffline in
+// offline mode.
+func (c *Client) requestToken(ctx context.Context, h *http.Client, method, url, token string, hdr map[string]string, body io.ReadSeeker, retry bool) (*http.Response, error) {
+	if c.offline {
+		return nil, fmt.Errorf("request %s: %w", url, ErrOffline)
 	}
-	defer f.Close()
-
-	// Check if resp.ContentLength is small and skip output in this case.
-	if resp.ContentLength == 0 || resp.ContentLength >= 100*1024 {
-		bar := progressbar.DefaultBytes(resp.ContentLength, filepath.Base(dst))
-		_, err = io.Copy(io.MultiWriter(f, bar), resp.Body)
-	} else {
-		_, err = io.Copy(f, resp.Body)
+	if c.userAgent != "" {
+		hdr = maps.Clone(hdr)
+		if hdr == nil {
+			hdr = map[string]string{}
+		}
+		hdr["User-Agent"] = c.userAgent
 	}
-	return err
+	return authRequestBody(ctx, h, method, url, token, hdr, body, retry)
 }
 
 // AuthRequest does an authenticated HTTP request with a Bearer token, which retries automatically 429 and 5xx.
 //
-// Method must be HEAD or GET.
+// Method must be HEAD or GET. Use AuthRequestBody for other methods.
 func AuthRequest(ctx context.Context, h *http.Client, method, url, token string, hdr map[string]string) (*http.Response, error) {
 	if method != "HEAD" && method != "GET" {
 		return nil, fmt.Errorf("unsupported method %s", method)
 	}
+	return AuthRequestBody(ctx, h, method, url, token, hdr, nil)
+}
+
+// AuthRequestBody is like AuthRequest but accepts any method and an optional
+// body, e.g. for a POST or a PUT.
+//
+// The body is rewound before each attempt. The token is not sent when empty,
+// which is needed for presigned URLs. Only GET, HEAD and PUT are retried on 429
+// and 5xx, since retrying another method may apply the change twice.
+func AuthRequestBody(ctx context.Context, h *http.Client, method, url, token string, hdr map[string]string, body io.ReadSeeker) (*http.Response, error) {
+	return authRequestBody(ctx, h, method, url, token, hdr, body, isIdempotent(method))
+}
+
+// isIdempotent returns true if a request with this method can safely be sent
+// again.
+func isIdempotent(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "PUT"
+}
+
+// authRequestBody implements AuthRequestBody. 429 and 5xx are retried only
+// when retry is true.
+func authRequestBody(ctx context.Context, h *http.Client, method, url, token string, hdr map[string]string, body io.ReadSeeker, retry bool) (*http.Response, error) {
 	slog.Info("hf", method, url)
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
-	if err != nil {
-		// Unlikely.
-		return nil, err
-	}
-	if token != "" {
-		req.Header.Add("Authorization", "Bearer "+token)
-	}
-	for k, v := range hdr {
-		req.Header.Add(k, v)
+	var size int64
+	if body != nil {
+		var err error
+		if size, err = body.Seek(0, io.SeekEnd); err != nil {
+			return nil, err
+		}
 	}
 	for i := 0; i < 10; i++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			// Unlikely.
+			return nil, err
+		}
+		if body != nil {
+			if _, err = body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			// Set the length explicitly so the body is not sent chunked, which
+			// presigned storage URLs refuse.
+			req.Body = io.NopCloser(body)
+			req.ContentLength = size
+			req.GetBody = func() (io.ReadCloser, error) {
+				_, err2 := body.Seek(0, io.SeekStart)
+				return io.NopCloser(body), err2
+			}
+			if size == 0 {
+				req.Body = http.NoBody
+			}
+		}
+		if token != "" {
+			req.Header.Add("Authorization", "Bearer "+token)
+		}
+		for k, v := range hdr {
+			req.Header.Add(k, v)
+		}
 		resp, err := h.Do(req)
+		if err != nil {
+			return nil, err
+		}
 		if resp.StatusCode >= 400 {
+			b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
 			_, _ = io.Copy(io.Discard, resp.Body)
 			_ = resp.Body.Close()
+			if e := parseHubError(resp, b); e != nil && resp.StatusCode < 500 {
+				return nil, e
+			}
 			if resp.StatusCode == 401 {
 				if token != "" {
 					return nil, fmt.Errorf("request %s: double check if your token is valid: %s", url, resp.Status)
 				}
 				return nil, fmt.Errorf("request %s: a valid token is likely required: %s", url, resp.Status)
 			}
-			if resp.StatusCode == 429 || (resp.StatusCode >= 500 && resp.StatusCode < 600) {
+			if retry && (resp.StatusCode == 429 || (resp.StatusCode >= 500 && resp.StatusCode < 600)) {
 				// Sleep and retry.
-				time.Sleep(time.Duration(i+1) * time.Second)
+				t := time.NewTimer(time.Duration(i+1) * time.Second)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return nil, ctx.Err()
+				case <-t.C:
+				}
 				continue
 			}
 			return nil, fmt.Errorf("request %s: status: %s", url, resp.Status)
 		}
-		return resp, err
+		return resp, nil
 	}
 	return nil, fmt.Errorf("request %s: failed retrying on 429", url)
 }
@@ -6,11 +6,15 @@ package huggingface
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -26,16 +30,17 @@ func TestGetModelInfo(t *testing.T) {
 		if r.URL.Path != "/api/models/microsoft/Phi-3-mini-4k-instruct/revision/main" {
 			t.Errorf("unexpected path, got: %s", r.URL.Path)
 		}
+		if r.URL.RawQuery != "blobs=true" {
+			t.Errorf("unexpected query, got: %s", r.URL.RawQuery)
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(apiRepoPhi3Data))
 	}))
 	defer server.Close()
-	os.Setenv("HF_HOME", t.TempDir())
-	c, err := New("")
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
 	if err != nil {
 		t.Fatal(err)
 	}
-	c.serverBase = server.URL
 
 	got := Model{
 		ModelRef: ModelRef{
@@ -79,11 +84,182 @@ func TestGetModelInfo(t *testing.T) {
 		License:    "mit",
 		LicenseURL: "https://huggingface.co/microsoft/Phi-3-mini-4k-instruct/resolve/main/LICENSE",
 	}
+	for _, f := range want.Files {
+		want.FileInfos = append(want.FileInfos, FileInfo{Filename: f})
+	}
+	want.FileInfos[0].Size = 1519
+	want.FileInfos[0].BlobID = "a6344aac8c09253b3b630fb776ae94478aa0275b"
+	want.FileInfos[10].Size = 4972489328
+	want.FileInfos[10].BlobID = "7b9e3a29ff1bbe7dc3d1dd2e43b1ad8e5d6d9c2e"
+	want.FileInfos[10].LFS = &LFSInfo{
+		SHA256:      "b4ff6a1d4f0c8b3b4d3e4ce4bc0ef5c6a8b3a7f5d4a7a5a1c5e55b7c1ac0e4b0",
+		Size:        4972489328,
+		PointerSize: 135,
+	}
 	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(want)); diff != "" {
 		t.Fatal(diff)
 	}
 }
 
+func TestNew_Options(t *testing.T) {
+	var gotUA, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(apiRepoPhi3Data))
+	}))
+	defer server.Close()
+	home := t.TempDir()
+	cache := t.TempDir()
+	c, err := New("",
+		WithEndpoint(server.URL+"/"),
+		WithHomeDir(home),
+		WithCacheDir(cache),
+		WithTransport(http.DefaultTransport),
+		WithTokenSource(func() (string, error) { return "hf_secret", nil }),
+		WithUserAgent("test/1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.hubHomeDir != home || c.hubCacheDir != cache {
+		t.Fatalf("unexpected dirs %q %q", c.hubHomeDir, c.hubCacheDir)
+	}
+	m := Model{ModelRef: ModelRef{Author: "microsoft", Repo: "Phi-3-mini-4k-instruct"}}
+	if err := c.GetModelInfo(context.Background(), &m, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if gotUA != "test/1.0" {
+		t.Fatalf("unexpected user agent %q", gotUA)
+	}
+	if gotAuth != "Bearer hf_secret" {
+		t.Fatalf("unexpected authorization %q", gotAuth)
+	}
+}
+
+func TestNew_NilHTTPClient(t *testing.T) {
+	_, c := newFakeHub(t, map[string][]byte{"config.json": []byte("{}")})
+	c, err := New("", WithEndpoint(c.serverBase), WithHomeDir(t.TempDir()), WithHTTPClient(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.EnsureFile(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", "config.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	t.Setenv("HF_ENDPOINT", "https://mirror.example.com/")
+	ref := ModelRef{Author: "a", Repo: "b"}
+	if got := ref.URL(); got != "https://mirror.example.com/a/b" {
+		t.Fatal(got)
+	}
+	c, err := New("", WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.serverBase != "https://mirror.example.com" {
+		t.Fatal(c.serverBase)
+	}
+	if c, err = New("", WithEndpoint("https://other.example.com"), WithHomeDir(t.TempDir())); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.RepoURL(RepoRef{Type: DatasetType, Author: "a", Repo: "b"}); got != "https://other.example.com/datasets/a/b" {
+		t.Fatal(got)
+	}
+}
+
+func TestGetFileInfo_MirrorRedirect(t *testing.T) {
+	const etag = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/a/b/resolve/main/model.bin" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		w.Header().Set("X-Repo-Commit", fakeCommit)
+		w.Header().Set("X-Linked-Etag", "\""+etag+"\"")
+		w.Header().Set("X-Linked-Size", "1234")
+		// The redirect to the CDN must not be followed.
+		http.Redirect(w, r, "http://cdn.invalid/blob", http.StatusFound)
+	}))
+	defer hub.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, hub.URL+r.URL.String(), http.StatusTemporaryRedirect)
+	}))
+	defer mirror.Close()
+	t.Setenv("HF_ENDPOINT", mirror.URL)
+	c, err := New("", WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, gotEtag, size, err := c.GetFileInfo(context.Background(), ModelRef{Author: "a", Repo: "b"}, "main", "model.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != fakeCommit || gotEtag != etag || size != 1234 {
+		t.Fatal(commit, gotEtag, size)
+	}
+}
+
+func TestAuthRequestBody_Retry(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// A POST is not sent twice.
+	if _, err := AuthRequestBody(ctx, server.Client(), "POST", server.URL, "", nil, strings.NewReader("{}")); err == nil {
+		t.Fatal("expected error")
+	}
+	// A GET is retried until the context is done, without waiting for the
+	// backoff to expire.
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := AuthRequest(ctx, server.Client(), "GET", server.URL, "", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 900*time.Millisecond {
+		t.Fatalf("took %s", d)
+	}
+	if requests["POST"] != 1 || requests["GET"] != 1 {
+		t.Fatalf("unexpected requests %v", requests)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "main")
+	if err := writeFileAtomic(p, []byte(fakeCommit)); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(p); err != nil || string(b) != fakeCommit {
+		t.Fatalf("unexpected content %q: %v", b, err)
+	}
+	// The permissions are the same as a file written normally.
+	ref := filepath.Join(dir, "ref")
+	if err := os.WriteFile(ref, nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	fi1, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi1.Mode() != fi2.Mode() {
+		t.Fatalf("want mode %s, got %s", fi2.Mode(), fi1.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("unexpected files %v", entries)
+	}
+}
+
 var apiRepoPhi3Data = `
 {
 		"lastModified": "2024-07-01T21:16:50.000Z",
@@ -101,7 +277,9 @@ var apiRepoPhi3Data = `
     },
     "siblings": [
         {
-            "rfilename": ".gitattributes"
+            "rfilename": ".gitattributes",
+            "blobId": "a6344aac8c09253b3b630fb776ae94478aa0275b",
+            "size": 1519
         },
         {
             "rfilename": "CODE_OF_CONDUCT.md"
@@ -131,7 +309,14 @@ var apiRepoPhi3Data = `
             "rfilename": "generation_config.json"
         },
         {
-            "rfilename": "model-00001-of-00002.safetensors"
+            "rfilename": "model-00001-of-00002.safetensors",
+            "blobId": "7b9e3a29ff1bbe7dc3d1dd2e43b1ad8e5d6d9c2e",
+            "size": 4972489328,
+            "lfs": {
+                "sha256": "b4ff6a1d4f0c8b3b4d3e4ce4bc0ef5c6a8b3a7f5d4a7a5a1c5e55b7c1ac0e4b0",
+                "size": 4972489328,
+                "pointerSize": 135
+            }
         },
         {
             "rfilename": "model-00002-of-00002.safetensors"
@@ -177,12 +362,10 @@ func TestGetModelInfo_Llama(t *testing.T) {
 		w.Write([]byte(apiRepoLlama3_2Data))
 	}))
 	defer server.Close()
-	os.Setenv("HF_HOME", t.TempDir())
-	c, err := New("")
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
 	if err != nil {
 		t.Fatal(err)
 	}
-	c.serverBase = server.URL
 
 	got := Model{
 		ModelRef: ModelRef{
@@ -193,6 +376,9 @@ func TestGetModelInfo_Llama(t *testing.T) {
 	if err := c.GetModelInfo(context.Background(), &got, "main"); err != nil {
 		t.Fatal(err)
 	}
+	if got.Gated != GatedManual || got.Private || got.Disabled {
+		t.Fatalf("unexpected access %q %t %t", got.Gated, got.Private, got.Disabled)
+	}
 	// TODO: verify.
 }
 
@@ -417,8 +603,10 @@ func TestMain(m *testing.M) {
 		NoColor:    !isatty.IsTerminal(os.Stderr.Fd()),
 	}))
 	slog.SetDefault(logger)
+	os.Unsetenv("HF_ENDPOINT")
 	os.Unsetenv("HF_HOME")
 	os.Unsetenv("HF_HUB_CACHE")
+	os.Unsetenv("HF_HUB_OFFLINE")
 	os.Unsetenv("HF_TOKEN")
 	os.Unsetenv("HF_TOKEN_PATH")
 	os.Exit(m.Run())
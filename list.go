@@ -0,0 +1,212 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListModelsOptions filters and sorts the models returned by ListModels.
+//
+// All fields are optional.
+type ListModelsOptions struct {
+	// Search is a substring of the model ID to search for.
+	Search string
+	// Author is the user or organization owning the models.
+	Author string
+	// Filter is a list of tags the models must all have, e.g. "gguf" or
+	// "license:mit".
+	Filter []string
+	// Library is the library of the models, e.g. "transformers".
+	Library string
+	// PipelineTag is the task of the models, e.g. "text-generation".
+	PipelineTag string
+	// Sort is the property to sort by, e.g. "downloads", "likes",
+	// "lastModified", "createdAt" or "trendingScore".
+	Sort string
+	// Ascending sorts in ascending order instead of descending.
+	Ascending bool
+	// Limit is the maximum number of models to return. 0 means no limit.
+	Limit int
+}
+
+// https://huggingface.co/docs/hub/api#get-apimodels
+type modelListItem struct {
+	HiddenID     string    `json:"_id"`
+	ID           string    `json:"id"`
+	ModelID      string    `json:"modelId"`
+	Author       string    `json:"author"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Downloads    int64     `json:"downloads"`
+	LastModified time.Time `json:"lastModified"`
+	LibraryName  string    `json:"library_name"`
+	Likes        int64     `json:"likes"`
+	PipelineTag  string    `json:"pipeline_tag"`
+	Private      bool      `json:"private"`
+	SHA          string    `json:"sha"`
+	Tags         []string  `json:"tags"`
+}
+
+// ListModels returns the models on the Hub matching opts.
+//
+// The results are fetched lazily one page at a time, following the Link
+// headers. Iteration stops after the first error.
+func (c *Client) ListModels(ctx context.Context, opts ListModelsOptions) iter.Seq2[Model, error] {
+	v := url.Values{}
+	if opts.Search != "" {
+		v.Set("search", opts.Search)
+	}
+	if opts.Author != "" {
+		v.Set("author", opts.Author)
+	}
+	for _, f := range opts.Filter {
+		v.Add("filter", f)
+	}
+	if opts.Library != "" {
+		v.Set("library", opts.Library)
+	}
+	if opts.PipelineTag != "" {
+		v.Set("pipeline_tag", opts.PipelineTag)
+	}
+	if opts.Sort != "" {
+		v.Set("sort", opts.Sort)
+		if opts.Ascending {
+			v.Set("direction", "1")
+		} else {
+			v.Set("direction", "-1")
+		}
+	}
+	if opts.Limit > 0 {
+		v.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	u := c.serverBase + "/api/models"
+	if len(v) != 0 {
+		u += "?" + v.Encode()
+	}
+	return func(yield func(Model, error) bool) {
+		i := 0
+		for item, err := range listPages[modelListItem](ctx, c, u) {
+			if err != nil {
+				yield(Model{}, err)
+				return
+			}
+			m := Model{
+				Tags:        item.Tags,
+				PipelineTag: item.PipelineTag,
+				Library:     item.LibraryName,
+				Downloads:   item.Downloads,
+				Likes:       item.Likes,
+				Private:     item.Private,
+				Created:     item.CreatedAt,
+				Modified:    item.LastModified,
+				SHA:         item.SHA,
+			}
+			m.Author, m.Repo, _ = strings.Cut(item.ID, "/")
+			if !yield(m, nil) {
+				return
+			}
+			if i++; opts.Limit > 0 && i >= opts.Limit {
+				return
+			}
+		}
+	}
+}
+
+// listPages fetches the JSON array at u and the following pages as
+// advertised in the Link header, yielding each item.
+func listPages[T any](ctx context.Context, c *Client, u string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for next := u; next != ""; {
+			var items []T
+			hdr, err := c.getJSON(ctx, next, &items)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			next = nextLink(hdr)
+		}
+	}
+}
+
+// getJSON does a GET request to u and decodes the JSON response into out.
+//
+// Returns the response headers.
+func (c *Client) getJSON(ctx context.Context, u string, out any) (http.Header, error) {
+	resp, err := c.request(ctx, c.h, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", u, err)
+	}
+	return resp.Header, nil
+}
+
+// sendJSON does a request to u with in encoded as JSON and decodes the JSON
+// response into out, unless out is nil.
+//
+// hdr defaults the Content-Type to application/json.
+func (c *Client) sendJSON(ctx context.Context, method, u string, hdr map[string]string, in, out any) error {
+	return c.sendJSONImpl(ctx, method, u, hdr, in, out, isIdempotent(method))
+}
+
+// queryJSON is sendJSON for a POST that doesn't modify anything on the
+// server, e.g. the preupload check, so it is retried on 429 and 5xx.
+func (c *Client) queryJSON(ctx context.Context, u string, hdr map[string]string, in, out any) error {
+	return c.sendJSONImpl(ctx, "POST", u, hdr, in, out, true)
+}
+
+func (c *Client) sendJSONImpl(ctx context.Context, method, u string, hdr map[string]string, in, out any, retry bool) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if hdr == nil {
+		hdr = map[string]string{"Content-Type": "application/json"}
+	}
+	resp, err := c.requestToken(ctx, c.h, method, u, c.token, hdr, bytes.NewReader(b), retry)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", u, err)
+	}
+	return nil
+}
+
+var reLinkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="?next"?`)
+
+// nextLink returns the URL of the next page from the Link header, if any.
+func nextLink(h http.Header) string {
+	for _, l := range h.Values("Link") {
+		if m := reLinkNext.FindStringSubmatch(l); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListModels(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/models" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if r.URL.Query().Get("cursor") == "" {
+			if got := q.Encode(); got != "author=meta-llama&direction=-1&filter=gguf&filter=license%3Amit&limit=3&search=llama&sort=downloads" {
+				t.Errorf("unexpected query %s", got)
+			}
+			w.Header().Set("Link", "<"+server.URL+"/api/models?cursor=abc>; rel=\"next\"")
+			w.Write([]byte(`[{"id":"meta-llama/a","downloads":10,"likes":1,"tags":["gguf"],"pipeline_tag":"text-generation"},{"id":"meta-llama/b"}]`))
+			return
+		}
+		w.Write([]byte(`[{"id":"meta-llama/c"},{"id":"meta-llama/d"}]`))
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ListModelsOptions{
+		Search: "llama",
+		Author: "meta-llama",
+		Filter: []string{"gguf", "license:mit"},
+		Sort:   "downloads",
+		Limit:  3,
+	}
+	var got []string
+	for m, err := range c.ListModels(context.Background(), opts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m.RepoID())
+		if m.Repo == "a" && (m.Downloads != 10 || m.PipelineTag != "text-generation") {
+			t.Fatalf("unexpected model %+v", m)
+		}
+	}
+	// The limit applies across pages.
+	if len(got) != 3 || got[0] != "meta-llama/a" || got[2] != "meta-llama/c" {
+		t.Fatalf("unexpected models %q", got)
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	h := http.Header{}
+	h.Add("Link", `<https://a/prev>; rel="prev", <https://a/next>; rel="next"`)
+	if got := nextLink(h); got != "https://a/next" {
+		t.Fatal(got)
+	}
+	if got := nextLink(http.Header{}); got != "" {
+		t.Fatal(got)
+	}
+}
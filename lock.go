@@ -0,0 +1,82 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is the delay between attempts to take a lock held by
+// another process.
+const lockPollInterval = 100 * time.Millisecond
+
+// fileLock is an advisory lock held on a file in the .locks/ directory.
+//
+// The lock is held by the OS on the open file, so it is automatically released
+// when the process dies. A lock file left behind by a dead process is not
+// locked and is reused and deleted by the next owner.
+type fileLock struct {
+	path string
+	f    *os.File
+}
+
+// acquireLock takes the exclusive advisory lock at path.
+//
+// It waits until the lock is released by the other owner or ctx is canceled.
+func acquireLock(ctx context.Context, path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return nil, err
+	}
+	logged := false
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o666)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if ok {
+			// The previous owner deletes the file upon release. Make sure the file
+			// locked is still the one at path, otherwise try again.
+			st1, err1 := f.Stat()
+			st2, err2 := os.Stat(path)
+			if err1 == nil && err2 == nil && os.SameFile(st1, st2) {
+				return &fileLock{path: path, f: f}, nil
+			}
+			_ = unlockFile(f)
+			_ = f.Close()
+			continue
+		}
+		_ = f.Close()
+		if !logged {
+			slog.Info("hf", "message", "waiting for lock", "lock", path)
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// release deletes the lock file and releases the lock.
+func (l *fileLock) release() error {
+	// Deleting the file fails on Windows since it is open. It is fine to leave
+	// it behind.
+	_ = os.Remove(l.path)
+	err := unlockFile(l.f)
+	if err2 := l.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
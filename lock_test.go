@@ -0,0 +1,45 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "models--a--b", "etag.lock")
+	ctx := context.Background()
+	l, err := acquireLock(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lock is held, waiting must honor the context.
+	ctx2, cancel := context.WithTimeout(ctx, 2*lockPollInterval)
+	defer cancel()
+	if _, err = acquireLock(ctx2, p); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// Release the lock while another waiter is pending.
+	done := make(chan error)
+	go func() {
+		l2, err2 := acquireLock(ctx, p)
+		if err2 == nil {
+			err2 = l2.release()
+		}
+		done <- err2
+	}()
+	time.Sleep(lockPollInterval / 2)
+	if err = l.release(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
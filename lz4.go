@@ -0,0 +1,151 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// lz4FrameMagic is the magic number starting an LZ4 frame.
+const lz4FrameMagic = 0x184D2204
+
+var errLZ4Corrupted = errors.New("lz4: corrupted data")
+
+// lz4DecodeFrame decompresses a complete LZ4 frame and appends the result to
+// dst.
+//
+// Both independent and linked blocks are supported. Checksums are skipped;
+// the content is verified by the caller. Dictionaries are not supported.
+//
+// See https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md
+func lz4DecodeFrame(dst, src []byte) ([]byte, error) {
+	if len(src) < 7 || binary.LittleEndian.Uint32(src) != lz4FrameMagic {
+		return nil, errors.New("lz4: invalid frame magic")
+	}
+	flg := src[4]
+	if flg>>6 != 1 {
+		return nil, fmt.Errorf("lz4: unsupported frame version %d", flg>>6)
+	}
+	if flg&1 != 0 {
+		return nil, errors.New("lz4: dictionaries are not supported")
+	}
+	blockChecksum := flg&0x10 != 0
+	contentSize := flg&0x08 != 0
+	contentChecksum := flg&0x04 != 0
+	// Skip FLG, BD, the optional content size and the header checksum.
+	i := 6
+	if contentSize {
+		i += 8
+	}
+	i++
+	// Back-references of linked blocks can reach into the previous blocks, so
+	// all blocks are decoded into the same buffer.
+	start := len(dst)
+	for {
+		if i+4 > len(src) {
+			return nil, errLZ4Corrupted
+		}
+		n := binary.LittleEndian.Uint32(src[i:])
+		i += 4
+		if n == 0 {
+			// End mark.
+			break
+		}
+		size := int(n & 0x7FFFFFFF)
+		if i+size > len(src) {
+			return nil, errLZ4Corrupted
+		}
+		if n&0x80000000 != 0 {
+			// Uncompressed block.
+			dst = append(dst, src[i:i+size]...)
+		} else {
+			var err error
+			if dst, err = lz4DecodeBlock(dst, src[i:i+size], start); err != nil {
+				return nil, err
+			}
+		}
+		i += size
+		if blockChecksum {
+			i += 4
+		}
+	}
+	if contentChecksum {
+		i += 4
+	}
+	if i > len(src) {
+		return nil, errLZ4Corrupted
+	}
+	return dst, nil
+}
+
+// lz4DecodeBlock decompresses an LZ4 block and appends the result to dst.
+//
+// Back-references can reach the data in dst back to dst[base:].
+//
+// See https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+func lz4DecodeBlock(dst, src []byte, base int) ([]byte, error) {
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		// Literals.
+		n := int(token >> 4)
+		if n == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupted
+				}
+				b := src[i]
+				i++
+				n += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if i+n > len(src) {
+			return nil, errLZ4Corrupted
+		}
+		dst = append(dst, src[i:i+n]...)
+		i += n
+		if i == len(src) {
+			// The last sequence has only literals.
+			break
+		}
+
+		// Match.
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupted
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		if offset == 0 || offset > len(dst)-base {
+			return nil, errLZ4Corrupted
+		}
+		n = int(token & 15)
+		if n == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupted
+				}
+				b := src[i]
+				i++
+				n += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		n += 4
+		// The match can overlap with the data being written, so copy byte by
+		// byte.
+		p := len(dst) - offset
+		for j := 0; j < n; j++ {
+			dst = append(dst, dst[p+j])
+		}
+	}
+	return dst, nil
+}
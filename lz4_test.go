@@ -0,0 +1,131 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// lz4Frame returns an LZ4 frame with the blocks, which are compressed unless
+// their size has the high bit set.
+func lz4Frame(flg byte, blocks ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, lz4FrameMagic)
+	// FLG, BD (64KiB blocks) and the header checksum, which is not verified.
+	b = append(b, flg, 0x40, 0)
+	for _, blk := range blocks {
+		b = append(b, blk...)
+	}
+	return binary.LittleEndian.AppendUint32(b, 0)
+}
+
+// lz4Block returns a compressed block prefixed with its size.
+func lz4Block(data []byte) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(data))), data...)
+}
+
+// lz4Literals returns an LZ4 frame made of a single block of literals.
+func lz4Literals(data []byte) []byte {
+	n := len(data)
+	var blk []byte
+	if n < 15 {
+		blk = append(blk, byte(n<<4))
+	} else {
+		blk = append(blk, 0xF0)
+		for n -= 15; n >= 255; n -= 255 {
+			blk = append(blk, 255)
+		}
+		blk = append(blk, byte(n))
+	}
+	return lz4Frame(0x60, lz4Block(append(blk, data...)))
+}
+
+func TestLZ4DecodeFrame(t *testing.T) {
+	long := bytes.Repeat([]byte("0123456789"), 100)
+	data := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"empty", lz4Frame(0x60), ""},
+		{"literals", lz4Literals([]byte("hello")), "hello"},
+		{"long_literals", lz4Literals(long), string(long)},
+		{
+			"match",
+			lz4Frame(0x60, lz4Block([]byte{0x35, 'a', 'b', 'c', 3, 0, 0x10, 'd'})),
+			"abcabcabcabcd",
+		},
+		{
+			"long_match",
+			lz4Frame(0x60, lz4Block([]byte{0x1F, 'a', 1, 0, 10})),
+			strings.Repeat("a", 30),
+		},
+		{
+			"uncompressed",
+			lz4Frame(0x60, append(binary.LittleEndian.AppendUint32(nil, 0x80000003), "raw"...)),
+			"raw",
+		},
+		{
+			// The second block references the first one.
+			"linked",
+			lz4Frame(0x40, lz4Block([]byte{0x30, 'x', 'y', 'z'}), lz4Block([]byte{0x02, 3, 0})),
+			"xyzxyzxyz",
+		},
+		{
+			// Content size, block and content checksums are skipped.
+			"checksums",
+			func() []byte {
+				b := binary.LittleEndian.AppendUint32(nil, lz4FrameMagic)
+				b = append(b, 0x7C, 0x40)
+				b = binary.LittleEndian.AppendUint64(b, 2)
+				b = append(b, 0)
+				b = append(b, lz4Block([]byte{0x20, 'o', 'k'})...)
+				b = append(b, 1, 2, 3, 4)
+				b = binary.LittleEndian.AppendUint32(b, 0)
+				return append(b, 5, 6, 7, 8)
+			}(),
+			"ok",
+		},
+	}
+	for _, l := range data {
+		t.Run(l.name, func(t *testing.T) {
+			got, err := lz4DecodeFrame([]byte("prefix"), l.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "prefix"+l.want {
+				t.Fatalf("got %q", got)
+			}
+		})
+	}
+}
+
+func TestLZ4DecodeFrame_Error(t *testing.T) {
+	data := []struct {
+		name string
+		in   []byte
+	}{
+		{"short", []byte{1, 2, 3}},
+		{"magic", append(binary.LittleEndian.AppendUint32(nil, 0x184D2205), 0x60, 0x40, 0, 0, 0, 0, 0)},
+		{"version", lz4Frame(0x80)},
+		{"dictionary", lz4Frame(0x61)},
+		{"no_end_mark", lz4Literals([]byte("a"))[:12]},
+		{"truncated_block", lz4Frame(0x60, binary.LittleEndian.AppendUint32(nil, 10))},
+		{"truncated_literals", lz4Frame(0x60, lz4Block([]byte{0x50, 'a'}))},
+		{"offset_zero", lz4Frame(0x60, lz4Block([]byte{0x10, 'a', 0, 0}))},
+		// The back-reference must not reach the data before the frame.
+		{"offset_too_far", lz4Frame(0x60, lz4Block([]byte{0x10, 'a', 2, 0}))},
+		{"truncated_offset", lz4Frame(0x60, lz4Block([]byte{0x10, 'a', 1}))},
+	}
+	for _, l := range data {
+		t.Run(l.name, func(t *testing.T) {
+			if _, err := lz4DecodeFrame([]byte("prefix"), l.in); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrOffline is returned when a network request is attempted in offline mode.
+var ErrOffline = errors.New("network access disabled in offline mode")
+
+// NotInCacheError is returned in offline mode when the requested revision or
+// file is not in the local cache.
+type NotInCacheError struct {
+	// Repo is the repository ID.
+	Repo string
+	// Revision is the revision requested.
+	Revision string
+	// File is the file requested, if any.
+	File string
+}
+
+func (e *NotInCacheError) Error() string {
+	if e.File != "" {
+		return "offline mode: " + e.Repo + "@" + e.Revision + ": " + e.File + " is not in the cache"
+	}
+	return "offline mode: " + e.Repo + "@" + e.Revision + " is not in the cache"
+}
+
+// reTmpFile matches the temporary files created by writeFileAtomic and
+// makeSnapshotSymlink before they are renamed into place.
+var reTmpFile = regexp.MustCompile(`\.\d+\.\d+\.tmp$`)
+
+// cachedSnapshot returns the files in the snapshot of the commit that match
+// glob, without doing any network access.
+func (c *Client) cachedSnapshot(ref RepoRef, revision, snapshotDir string, glob []string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(snapshotDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || reTmpFile.MatchString(p) {
+			return nil
+		}
+		// Skip dangling symlinks.
+		if _, err = os.Stat(p); err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(snapshotDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(files) == 0) {
+		return nil, &NotInCacheError{Repo: ref.RepoID(), Revision: revision}
+	}
+	if err != nil {
+		return nil, err
+	}
+	desired, err := matchGlobs(files, glob)
+	if errors.Is(err, errNoGlobMatch) {
+		// The files may exist in the repository but are not in the cache.
+		return nil, &NotInCacheError{Repo: ref.RepoID(), Revision: revision, File: strings.Join(glob, ", ")}
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(desired))
+	for i, f := range desired {
+		out[i] = filepath.Join(snapshotDir, f)
+	}
+	return out, nil
+}
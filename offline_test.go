@@ -0,0 +1,90 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOffline(t *testing.T) {
+	files := map[string][]byte{
+		"config.json":   []byte("{}"),
+		"data.tmp":      []byte("data"),
+		"x.incomplete":  []byte("x"),
+		"dir/model.bin": []byte("weights"),
+	}
+	f, c := newFakeHub(t, files)
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	if _, err := c.EnsureSnapshot(ctx, ref, "main", []string{"config.json", "data.tmp", "x.incomplete"}); err != nil {
+		t.Fatal(err)
+	}
+	// A leftover from an interrupted symlink creation is ignored.
+	snapshotDir := filepath.Join(c.hubCacheDir, "models--author--repo", "snapshots", fakeCommit)
+	if err := os.WriteFile(filepath.Join(snapshotDir, "config.json.123.456.tmp"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("HF_HUB_OFFLINE", "1")
+	off, err := New("", WithEndpoint(c.serverBase), WithHomeDir(c.hubHomeDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No network access is done.
+	f.revisions, f.heads, f.ranges = 0, 0, nil
+	defer func() {
+		if f.revisions != 0 || f.heads != 0 || len(f.ranges) != 0 {
+			t.Errorf("unexpected requests: %d revisions, %d HEAD, %q", f.revisions, f.heads, f.ranges)
+		}
+	}()
+	for _, rev := range []string{"main", fakeCommit} {
+		got, err := off.EnsureSnapshot(ctx, ref, rev, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{filepath.Join(snapshotDir, "config.json"), filepath.Join(snapshotDir, "data.tmp"), filepath.Join(snapshotDir, "x.incomplete")}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatal(diff)
+		}
+		if _, err = off.EnsureFile(ctx, ref, rev, "config.json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var nerr *NotInCacheError
+	if _, err = off.EnsureFile(ctx, ref, "main", "dir/model.bin"); !errors.As(err, &nerr) || nerr.File != "dir/model.bin" {
+		t.Fatalf("expected NotInCacheError, got %v", err)
+	}
+	if _, err = off.EnsureSnapshot(ctx, ref, "main", []string{"*.safetensors"}); !errors.As(err, &nerr) || nerr.File != "*.safetensors" {
+		t.Fatalf("expected NotInCacheError, got %v", err)
+	}
+	if _, err = off.EnsureSnapshot(ctx, ref, "main", []string{"["}); err == nil || errors.As(err, &nerr) {
+		t.Fatalf("expected invalid glob error, got %v", err)
+	}
+	if _, err = off.EnsureSnapshot(ctx, ref, "v1.0", nil); !errors.As(err, &nerr) || nerr.Revision != "v1.0" {
+		t.Fatalf("expected NotInCacheError, got %v", err)
+	}
+	if _, err = off.EnsureSnapshot(ctx, ModelRef{Author: "author", Repo: "other"}, "main", nil); !errors.As(err, &nerr) {
+		t.Fatalf("expected NotInCacheError, got %v", err)
+	}
+	if err = off.GetModelInfo(ctx, &Model{ModelRef: ref}, "main"); !errors.Is(err, ErrOffline) {
+		t.Fatalf("expected ErrOffline, got %v", err)
+	}
+
+	// The option overrides the environment variable.
+	on, err := New("", WithEndpoint("http://127.0.0.1:1"), WithHomeDir(c.hubHomeDir), WithOffline(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on.offline {
+		t.Fatal("expected online")
+	}
+}
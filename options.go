@@ -0,0 +1,109 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Option configures a Client in New.
+type Option func(o *options)
+
+type options struct {
+	h           *http.Client
+	endpoint    string
+	homeDir     string
+	cacheDir    string
+	tokenSource func() (string, error)
+	userAgent   string
+	offline     bool
+	checkToken  context.Context
+}
+
+// WithHTTPClient sets the *http.Client used for all requests. Defaults to
+// http.DefaultClient, which is also used when h is nil.
+//
+// Use it to configure proxies, mTLS or timeouts.
+func WithHTTPClient(h *http.Client) Option {
+	return func(o *options) {
+		if h == nil {
+			h = http.DefaultClient
+		}
+		o.h = h
+	}
+}
+
+// WithTransport sets the http.RoundTripper used for all requests.
+//
+// It is a shorthand for WithHTTPClient(&http.Client{Transport: rt}).
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.h = &http.Client{Transport: rt}
+	}
+}
+
+// WithEndpoint sets the Hub's base URL. Defaults to https://huggingface.co.
+//
+// Use it to point the client to a test server.
+func WithEndpoint(url string) Option {
+	return func(o *options) {
+		o.endpoint = strings.TrimRight(url, "/")
+	}
+}
+
+// WithHomeDir sets the directory holding the token and the cache, overriding
+// the environment variable HF_HOME.
+func WithHomeDir(dir string) Option {
+	return func(o *options) {
+		o.homeDir = dir
+	}
+}
+
+// WithCacheDir sets the directory holding the downloaded files, overriding
+// the environment variable HF_HUB_CACHE.
+func WithCacheDir(dir string) Option {
+	return func(o *options) {
+		o.cacheDir = dir
+	}
+}
+
+// WithTokenSource sets the function called to retrieve the token when none is
+// passed to New, instead of looking up the environment variable HF_TOKEN and
+// the token file.
+func WithTokenSource(f func() (string, error)) Option {
+	return func(o *options) {
+		o.tokenSource = f
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(o *options) {
+		o.userAgent = ua
+	}
+}
+
+// WithOffline enables or disables the offline mode, overriding the environment
+// variable HF_HUB_OFFLINE.
+//
+// In offline mode, EnsureFile and EnsureSnapshot resolve revisions and files
+// only from the local cache and return a *NotInCacheError when something is
+// missing. Other calls fail with ErrOffline.
+func WithOffline(offline bool) Option {
+	return func(o *options) {
+		o.offline = offline
+	}
+}
+
+// WithTokenCheck makes New call WhoAmI with ctx to confirm the token is valid,
+// so an invalid or missing token is reported before any download starts. An
+// explicit token is saved to the cache only once validated.
+func WithTokenCheck(ctx context.Context) Option {
+	return func(o *options) {
+		o.checkToken = ctx
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// ProgressReporter receives the progress of downloads.
+//
+// A batch of downloads is started by EnsureFile or EnsureSnapshot. Methods may
+// be called concurrently.
+type ProgressReporter interface {
+	// Start is called when a batch of downloads starts with the number of files
+	// to download and their total size in bytes.
+	Start(files int, total int64)
+	// FileStart is called when a file starts downloading.
+	FileStart(name string, size int64)
+	// FileProgress is called when n bytes of the file were transferred. n is
+	// negative when a download is restarted.
+	FileProgress(name string, n int64)
+	// FileDone is called when the file is successfully downloaded.
+	FileDone(name string)
+	// FileError is called when downloading the file failed.
+	FileError(name string, err error)
+	// Done is called when the batch is completed, successfully or not.
+	Done()
+}
+
+// NoProgress is a ProgressReporter that ignores all events.
+type NoProgress struct{}
+
+// Start implements ProgressReporter.
+func (NoProgress) Start(files int, total int64) {}
+
+// FileStart implements ProgressReporter.
+func (NoProgress) FileStart(name string, size int64) {}
+
+// FileProgress implements ProgressReporter.
+func (NoProgress) FileProgress(name string, n int64) {}
+
+// FileDone implements ProgressReporter.
+func (NoProgress) FileDone(name string) {}
+
+// FileError implements ProgressReporter.
+func (NoProgress) FileError(name string, err error) {}
+
+// Done implements ProgressReporter.
+func (NoProgress) Done() {}
+
+// NewProgressBar returns a ProgressReporter that draws a progress bar of the
+// aggregate download to w, usually os.Stderr.
+//
+// Concurrent batches share the same bar, which is completed once they are all
+// done. The bar is skipped when the downloads are less than 100kiB.
+func NewProgressBar(w io.Writer) ProgressReporter {
+	return &barProgress{w: w}
+}
+
+type barProgress struct {
+	NoProgress
+	w io.Writer
+
+	mu  sync.Mutex
+	bar *progressbar.ProgressBar
+	// active is the number of batches started and not done yet. The other
+	// counters are the sum over these batches.
+	active int
+	files  int
+	total  int64
+	done   int64
+}
+
+func (b *barProgress) Start(files int, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active++
+	b.files += files
+	b.total += total
+	if b.bar != nil && !b.bar.IsFinished() {
+		b.bar.ChangeMax64(b.total)
+		b.bar.Describe(fmt.Sprintf("downloading (%d)", b.files))
+		return
+	}
+	b.bar = nil
+	if b.total < 100*1024 {
+		return
+	}
+	// When there is a single file, its name is set in FileStart.
+	title := ""
+	if b.files != 1 {
+		title = fmt.Sprintf("downloading (%d)", b.files)
+	}
+	b.bar = progressbar.NewOptions64(
+		b.total,
+		progressbar.OptionSetDescription(title),
+		progressbar.OptionSetWriter(b.w),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionShowTotalBytes(true),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(b.w, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+	if b.done != 0 {
+		_ = b.bar.Set64(b.done)
+	}
+}
+
+func (b *barProgress) FileStart(name string, size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.bar != nil && b.files == 1 {
+		b.bar.Describe(filepath.Base(name))
+	}
+}
+
+func (b *barProgress) FileProgress(name string, n int64) {
+	b.mu.Lock()
+	b.done += n
+	bar := b.bar
+	b.mu.Unlock()
+	if bar != nil {
+		_ = bar.Add64(n)
+	}
+}
+
+func (b *barProgress) Done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active--; b.active != 0 {
+		return
+	}
+	// Terminate the line when a download failed before the bar completed.
+	if b.bar != nil && !b.bar.IsFinished() {
+		_ = b.bar.Exit()
+	}
+	b.bar = nil
+	b.files = 0
+	b.total = 0
+	b.done = 0
+}
+
+// NewSlogProgress returns a ProgressReporter that logs structured events to l.
+//
+// File start, completion and errors are always logged. The aggregate progress
+// of the concurrent batches is logged at most once per interval.
+func NewSlogProgress(l *slog.Logger, interval time.Duration) ProgressReporter {
+	return &slogProgress{l: l, interval: interval}
+}
+
+type slogProgress struct {
+	l        *slog.Logger
+	interval time.Duration
+
+	mu sync.Mutex
+	// active is the number of batches started and not done yet. The other
+	// fields are for these batches.
+	active  int
+	files   int
+	total   int64
+	done    int64
+	started time.Time
+	last    time.Time
+}
+
+func (s *slogProgress) Start(files int, total int64) {
+	s.mu.Lock()
+	if s.active == 0 {
+		s.started = time.Now()
+		s.last = s.started
+	}
+	s.active++
+	s.files += files
+	s.total += total
+	s.mu.Unlock()
+	s.l.Info("hf", "message", "download started", "files", files, "total", total)
+}
+
+func (s *slogProgress) FileStart(name string, size int64) {
+	s.l.Info("hf", "message", "file download started", "file", name, "size", size)
+}
+
+func (s *slogProgress) FileProgress(name string, n int64) {
+	s.mu.Lock()
+	s.done += n
+	now := time.Now()
+	if now.Sub(s.last) < s.interval {
+		s.mu.Unlock()
+		return
+	}
+	s.last = now
+	done, total := s.done, s.total
+	s.mu.Unlock()
+	s.l.Info("hf", "message", "download progress", "done", done, "total", total)
+}
+
+func (s *slogProgress) FileDone(name string) {
+	s.l.Info("hf", "message", "file download done", "file", name)
+}
+
+func (s *slogProgress) FileError(name string, err error) {
+	s.l.Error("hf", "message", "file download failed", "file", name, "err", err)
+}
+
+func (s *slogProgress) Done() {
+	s.mu.Lock()
+	if s.active--; s.active != 0 {
+		s.mu.Unlock()
+		return
+	}
+	done, files, d := s.done, s.files, time.Since(s.started)
+	s.files = 0
+	s.total = 0
+	s.done = 0
+	s.mu.Unlock()
+	s.l.Info("hf", "message", "download done", "files", files, "done", done, "duration", d)
+}
+
+// fileProgress reports the bytes written to it as the progress of a file.
+type fileProgress struct {
+	p    ProgressReporter
+	name string
+}
+
+func (f *fileProgress) Write(b []byte) (int, error) {
+	f.p.FileProgress(f.name, int64(len(b)))
+	return len(b), nil
+}
+
+func (f *fileProgress) add(n int64) {
+	if n != 0 {
+		f.p.FileProgress(f.name, n)
+	}
+}
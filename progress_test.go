@@ -0,0 +1,137 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type recordProgress struct {
+	mu       sync.Mutex
+	files    int
+	total    int64
+	started  []string
+	progress map[string]int64
+	done     []string
+	finished bool
+}
+
+func (r *recordProgress) Start(files int, total int64) {
+	r.files = files
+	r.total = total
+	r.progress = map[string]int64{}
+}
+
+func (r *recordProgress) FileStart(name string, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, name)
+}
+
+func (r *recordProgress) FileProgress(name string, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress[name] += n
+}
+
+func (r *recordProgress) FileDone(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = append(r.done, name)
+}
+
+func (r *recordProgress) FileError(name string, err error) {
+}
+
+func (r *recordProgress) Done() {
+	r.finished = true
+}
+
+func TestProgressReporter(t *testing.T) {
+	files := map[string][]byte{
+		"a.bin": bytes.Repeat([]byte("a"), 1000),
+		"b.bin": bytes.Repeat([]byte("b"), 2000),
+	}
+	_, c := newFakeHub(t, files)
+	r := &recordProgress{}
+	c.Progress = r
+	if _, err := c.EnsureSnapshot(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.files != 2 || r.total != 3000 || !r.finished {
+		t.Fatalf("unexpected totals: %d files, %d bytes, finished %t", r.files, r.total, r.finished)
+	}
+	if len(r.started) != 2 || len(r.done) != 2 {
+		t.Fatalf("unexpected events: %q %q", r.started, r.done)
+	}
+	if diff := cmp.Diff(map[string]int64{"a.bin": 1000, "b.bin": 2000}, r.progress); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestSlogProgress(t *testing.T) {
+	buf := bytes.Buffer{}
+	p := NewSlogProgress(slog.New(slog.NewTextHandler(&buf, nil)), 0)
+	p.Start(1, 10)
+	p.FileStart("a.bin", 10)
+	p.FileProgress("a.bin", 10)
+	p.FileDone("a.bin")
+	p.Done()
+	for _, want := range []string{"download started", "file download started", "download progress", "file download done", "download done"} {
+		if !strings.Contains(buf.String(), "message=\""+want+"\"") {
+			t.Fatalf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestProgressBar_Concurrent(t *testing.T) {
+	buf := bytes.Buffer{}
+	p := NewProgressBar(&buf).(*barProgress)
+	p.Start(1, 200*1024)
+	p.Start(2, 300*1024)
+	if p.bar == nil || p.bar.GetMax64() != 500*1024 {
+		t.Fatal("expected a bar for both batches")
+	}
+	p.FileProgress("a.bin", 200*1024)
+	p.Done()
+	// The first batch completing doesn't complete the bar.
+	if p.bar == nil || p.bar.IsFinished() {
+		t.Fatal("bar completed too early")
+	}
+	p.FileProgress("b.bin", 300*1024)
+	p.Done()
+	if p.bar != nil || p.active != 0 || p.total != 0 {
+		t.Fatalf("unexpected state %d %d", p.active, p.total)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Fatalf("expected the bar to complete once, got %d lines:\n%q", n, buf.String())
+	}
+}
+
+func TestSlogProgress_Concurrent(t *testing.T) {
+	buf := bytes.Buffer{}
+	p := NewSlogProgress(slog.New(slog.NewTextHandler(&buf, nil)), time.Hour)
+	p.Start(1, 10)
+	p.Start(2, 30)
+	p.FileProgress("a.bin", 10)
+	p.Done()
+	// The first batch completing doesn't end the download.
+	if strings.Contains(buf.String(), "download done") {
+		t.Fatalf("done too early:\n%s", buf.String())
+	}
+	p.FileProgress("b.bin", 30)
+	p.Done()
+	if !strings.Contains(buf.String(), "message=\"download done\" files=3 done=40") {
+		t.Fatalf("unexpected totals:\n%s", buf.String())
+	}
+}
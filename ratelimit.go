@@ -0,0 +1,98 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all the downloads of a Client.
+//
+// The bucket holds up to one second worth of bytes. Callers reserve the bytes
+// they transferred and sleep for the debt they created, so concurrent
+// transfers share the bandwidth.
+type rateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until n bytes can be transferred at rate bytes per second.
+//
+// It returns immediately if rate is 0 or less.
+func (r *rateLimiter) wait(ctx context.Context, n int, rate int64) error {
+	if rate <= 0 {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.last.IsZero() {
+		r.tokens = float64(rate)
+	} else {
+		r.tokens = min(float64(rate), r.tokens+now.Sub(r.last).Seconds()*float64(rate))
+	}
+	r.last = now
+	r.tokens -= float64(n)
+	d := time.Duration(-r.tokens / float64(rate) * float64(time.Second))
+	r.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limitedReader is an io.Reader throttled by a rateLimiter.
+type limitedReader struct {
+	ctx  context.Context
+	r    io.Reader
+	l    *rateLimiter
+	rate int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Keep reads small so the throughput is smooth.
+	if len(p) > 32*1024 {
+		p = p[:32*1024]
+	}
+	n, err := l.r.Read(p)
+	if err2 := l.l.wait(l.ctx, n, l.rate); err == nil {
+		err = err2
+	}
+	return n, err
+}
+
+// throttle returns r limited to the client's bandwidth limit, if any.
+//
+// A Client not created by New has no shared limiter, so each reader is
+// limited on its own.
+func (c *Client) throttle(ctx context.Context, r io.Reader) io.Reader {
+	if c.MaxBytesPerSecond <= 0 {
+		return r
+	}
+	l := c.limiter
+	if l == nil {
+		l = &rateLimiter{}
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l, rate: c.MaxBytesPerSecond}
+}
+
+// throttleSeeker is throttle for a request body, which must stay seekable so it
+// can be rewound on retry.
+func (c *Client) throttleSeeker(ctx context.Context, r io.ReadSeeker) io.ReadSeeker {
+	return struct {
+		io.Reader
+		io.Seeker
+	}{c.throttle(ctx, r), r}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	c := Client{MaxBytesPerSecond: 10000, limiter: &rateLimiter{}}
+	ctx := context.Background()
+	start := time.Now()
+	// The first second worth of bytes is the burst, the rest is throttled.
+	n, err := io.Copy(io.Discard, c.throttle(ctx, bytes.NewReader(make([]byte, 15000))))
+	if err != nil || n != 15000 {
+		t.Fatal(n, err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("too fast: %s", d)
+	}
+
+	ctx2, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = io.Copy(io.Discard, c.throttle(ctx2, bytes.NewReader(make([]byte, 15000)))); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
+
+func TestThrottle_NoLimiter(t *testing.T) {
+	// A Client literal has no limiter.
+	c := Client{MaxBytesPerSecond: 10000}
+	n, err := io.Copy(io.Discard, c.throttle(context.Background(), bytes.NewReader(make([]byte, 5000))))
+	if err != nil || n != 5000 {
+		t.Fatal(n, err)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitRef is a git reference in a repository.
+type GitRef struct {
+	// Name is the short name, e.g. "main", "v1.0", "parquet" or "1".
+	Name string `json:"name"`
+	// Ref is the full reference, e.g. "refs/heads/main", "refs/tags/v1.0",
+	// "refs/convert/parquet" or "refs/pr/1".
+	Ref string `json:"ref"`
+	// TargetCommit is the commit hash the reference points to.
+	TargetCommit string `json:"targetCommit"`
+}
+
+// GitRefs lists the references of a repository.
+type GitRefs struct {
+	// Branches are the references in refs/heads/.
+	Branches []GitRef `json:"branches"`
+	// Tags are the references in refs/tags/.
+	Tags []GitRef `json:"tags"`
+	// Converts are the references in refs/convert/, e.g. the parquet
+	// conversion of a dataset.
+	Converts []GitRef `json:"converts"`
+	// PullRequests are the references in refs/pr/. Only filled when requested.
+	PullRequests []GitRef `json:"pullRequests"`
+}
+
+// ListRefs returns the branches, tags and conversion references of the
+// repository and optionally its pull request references.
+//
+// Any of the reference names or Ref values can be used as a revision.
+func (c *Client) ListRefs(ctx context.Context, ref RepoRef, includePRs bool) (*GitRefs, error) {
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/refs"
+	if includePRs {
+		u += "?include_prs=1"
+	}
+	out := &GitRefs{}
+	if _, err := c.getJSON(ctx, u, out); err != nil {
+		return nil, fmt.Errorf("failed to list refs of %s: %w", ref.RepoID(), err)
+	}
+	return out, nil
+}
+
+type branchRequest struct {
+	StartingPoint string `json:"startingPoint,omitempty"`
+}
+
+// CreateBranch creates the branch at the revision. The branch starts at the
+// head of the default branch when revision is empty.
+//
+// It returns an error matching ErrConflict if the branch already exists.
+func (c *Client) CreateBranch(ctx context.Context, ref RepoRef, branch, revision string) error {
+	if err := checkRevision(branch); err != nil {
+		return err
+	}
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/branch/" + escapeRevision(branch)
+	if err := c.sendJSON(ctx, "POST", u, nil, &branchRequest{StartingPoint: revision}, nil); err != nil {
+		return fmt.Errorf("failed to create branch %q: %w", branch, err)
+	}
+	return c.invalidateRef(ref, "refs/heads/", branch)
+}
+
+// DeleteBranch deletes the branch.
+func (c *Client) DeleteBranch(ctx context.Context, ref RepoRef, branch string) error {
+	if err := checkRevision(branch); err != nil {
+		return err
+	}
+	if err := c.deleteRef(ctx, ref, "branch", branch); err != nil {
+		return fmt.Errorf("failed to delete branch %q: %w", branch, err)
+	}
+	return c.invalidateRef(ref, "refs/heads/", branch)
+}
+
+type tagRequest struct {
+	Tag     string `json:"tag"`
+	Message string `json:"message,omitempty"`
+}
+
+// CreateTag creates the tag on the revision, with an optional message. Use
+// "main" as the revision to tag the head of the default branch.
+//
+// It returns an error matching ErrConflict if the tag already exists.
+func (c *Client) CreateTag(ctx context.Context, ref RepoRef, tag, revision, message string) error {
+	if err := checkRevision(tag); err != nil {
+		return err
+	}
+	if err := checkRevision(revision); err != nil {
+		return err
+	}
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/tag/" + escapeRevision(revision)
+	if err := c.sendJSON(ctx, "POST", u, nil, &tagRequest{Tag: tag, Message: message}, nil); err != nil {
+		return fmt.Errorf("failed to create tag %q: %w", tag, err)
+	}
+	return c.invalidateRef(ref, "refs/tags/", tag)
+}
+
+// DeleteTag deletes the tag.
+func (c *Client) DeleteTag(ctx context.Context, ref RepoRef, tag string) error {
+	if err := checkRevision(tag); err != nil {
+		return err
+	}
+	if err := c.deleteRef(ctx, ref, "tag", tag); err != nil {
+		return fmt.Errorf("failed to delete tag %q: %w", tag, err)
+	}
+	return c.invalidateRef(ref, "refs/tags/", tag)
+}
+
+// deleteRef deletes the branch or tag name.
+func (c *Client) deleteRef(ctx context.Context, ref RepoRef, kind, name string) error {
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/" + kind + "/" + escapeRevision(name)
+	resp, err := c.request(ctx, c.h, "DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// invalidateRef removes the commit hash cached for the reference name, so the
+// next resolution fetches it from the Hub. Both the short name and the full
+// reference with prefix are removed.
+func (c *Client) invalidateRef(ref RepoRef, prefix, name string) error {
+	refs := c.refsDir(ref)
+	for _, n := range []string{name, prefix + name} {
+		p := filepath.Join(refs, filepath.FromSlash(n))
+		// A directory holds references with this name as a prefix.
+		if fi, err := os.Lstat(p); err != nil || fi.IsDir() {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeRevision escapes a revision to be used as a single URL path segment.
+//
+// This is needed for revisions containing slashes like "refs/pr/1".
+func escapeRevision(revision string) string {
+	return url.PathEscape(revision)
+}
+
+// checkRevision refuses revisions that could escape the refs/ directory of
+// the cache.
+func checkRevision(revision string) error {
+	if revision == "" || strings.HasPrefix(revision, "/") || strings.Contains(revision, "\\") {
+		return fmt.Errorf("invalid revision %q", revision)
+	}
+	for _, p := range strings.Split(revision, "/") {
+		if p == "" || p == "." || p == ".." {
+			return fmt.Errorf("invalid revision %q", revision)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListRefs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/models/a/b/refs" || r.URL.RawQuery != "include_prs=1" {
+			t.Errorf("unexpected URL, got: %s", r.URL)
+		}
+		w.Write([]byte(`{
+			"branches":[{"name":"main","ref":"refs/heads/main","targetCommit":"1111111111111111111111111111111111111111"}],
+			"converts":[],
+			"tags":[{"name":"v1.0","ref":"refs/tags/v1.0","targetCommit":"2222222222222222222222222222222222222222"}],
+			"pullRequests":[{"name":"1","ref":"refs/pr/1","targetCommit":"3333333333333333333333333333333333333333"}]
+		}`))
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.ListRefs(context.Background(), RepoRef{Author: "a", Repo: "b"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GitRefs{
+		Branches:     []GitRef{{Name: "main", Ref: "refs/heads/main", TargetCommit: "1111111111111111111111111111111111111111"}},
+		Tags:         []GitRef{{Name: "v1.0", Ref: "refs/tags/v1.0", TargetCommit: "2222222222222222222222222222222222222222"}},
+		Converts:     []GitRef{},
+		PullRequests: []GitRef{{Name: "1", Ref: "refs/pr/1", TargetCommit: "3333333333333333333333333333333333333333"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestEnsureFile_PRRef(t *testing.T) {
+	_, c := newFakeHub(t, map[string][]byte{"config.json": []byte("{}")})
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	if _, err := c.EnsureFile(ctx, ref, "refs/pr/1", "config.json"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(c.refsDir(ref), "refs", "pr", "1"))
+	if err != nil || string(b) != fakeCommit {
+		t.Fatalf("unexpected ref %q: %v", b, err)
+	}
+	if _, err = c.EnsureSnapshot(ctx, ref, "refs/pr/2", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range []string{"../main", "refs//1", "/abs", "a\\b"} {
+		if _, err = c.EnsureFile(ctx, ref, rev, "config.json"); err == nil {
+			t.Fatalf("expected error for %q", rev)
+		}
+	}
+}
+
+func TestBranchesAndTags(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, r.Method+" "+r.URL.EscapedPath()+" "+string(b))
+		if r.Method == "POST" && r.URL.Path == "/api/models/a/b/branch/exp" && len(got) > 1 {
+			w.Header().Set("X-Error-Message", "Reference already exists")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	c, err := New("hf_secret", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref := RepoRef{Author: "a", Repo: "b"}
+	// Stale cached references.
+	for _, n := range []string{"v1", "refs/tags/v1", "exp/x"} {
+		p := filepath.Join(c.refsDir(ref), filepath.FromSlash(n))
+		if err = os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(p, []byte(fakeCommit), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.CreateBranch(ctx, ref, "exp", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateBranch(ctx, ref, "exp", ""); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if err = c.CreateBranch(ctx, ref, "exp/x", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DeleteBranch(ctx, ref, "exp/x"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateTag(ctx, ref, "v1", "main", "Release"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DeleteTag(ctx, ref, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateTag(ctx, ref, "../v1", "main", ""); err == nil {
+		t.Fatal("expected error")
+	}
+	want := []string{
+		"POST /api/models/a/b/branch/exp {}",
+		"POST /api/models/a/b/branch/exp {}",
+		`POST /api/models/a/b/branch/exp%2Fx {"startingPoint":"v1"}`,
+		"DELETE /api/models/a/b/branch/exp%2Fx ",
+		`POST /api/models/a/b/tag/main {"tag":"v1","message":"Release"}`,
+		"DELETE /api/models/a/b/tag/v1 ",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+	for _, n := range []string{"v1", "refs/tags/v1", "exp/x"} {
+		if _, err = os.Stat(filepath.Join(c.refsDir(ref), filepath.FromSlash(n))); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected the cached reference to be removed: %v", n, err)
+		}
+	}
+}
+
+func TestRefsDir_Endpoint(t *testing.T) {
+	files := map[string][]byte{"config.json": []byte("{}")}
+	_, c := newFakeHub(t, files)
+	// A mirror sharing the same cache.
+	mirror, c2 := newFakeHub(t, files)
+	c2, err := New("", WithEndpoint(c2.serverBase), WithHomeDir(c.hubHomeDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	if _, err = c.EnsureFile(ctx, ref, "main", "config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c2.EnsureFile(ctx, ref, "main", "config.json"); err != nil {
+		t.Fatal(err)
+	}
+	// The reference cached for the first endpoint is not used for the mirror.
+	if mirror.revisions != 1 {
+		t.Fatalf("want 1 repository information request, got %d", mirror.revisions)
+	}
+	if c.refsDir(ref) == c2.refsDir(ref) {
+		t.Fatal(c.refsDir(ref))
+	}
+	hub, err := New("", WithEndpoint("https://huggingface.co"), WithHomeDir(c.hubHomeDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hub.refsDir(ref), filepath.Join(c.hubCacheDir, "models--author--repo", "refs"); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CreateRepoOptions configures the repository created with CreateRepo.
+type CreateRepoOptions struct {
+	// Private makes the repository visible only to its owner.
+	Private bool
+	// SpaceSDK is the SDK of a Space, e.g. "gradio", "streamlit", "docker" or
+	// "static". It is required for Spaces and ignored otherwise.
+	SpaceSDK string
+	// ExistOK makes CreateRepo succeed when the repository already exists.
+	ExistOK bool
+
+	_ struct{}
+}
+
+// RepoSettings are the settings changed by UpdateRepoSettings. Nil fields are
+// left unchanged.
+type RepoSettings struct {
+	// Private makes the repository visible only to its owner.
+	Private *bool
+	// Gated is the access request mode. Use GatedNone to remove the gate.
+	Gated *GatedMode
+	// DiscussionsDisabled disables the discussions and pull requests.
+	DiscussionsDisabled *bool
+
+	_ struct{}
+}
+
+// https://huggingface.co/docs/hub/api#post-apireposcreate
+type repoCreateRequest struct {
+	Name         string `json:"name"`
+	Organization string `json:"organization"`
+	Type         string `json:"type,omitempty"`
+	Private      bool   `json:"private"`
+	SDK          string `json:"sdk,omitempty"`
+}
+
+// CreateRepo creates the repository on the Hub.
+//
+// It returns an error matching ErrConflict if the repository already exists,
+// unless opts.ExistOK is set.
+func (c *Client) CreateRepo(ctx context.Context, ref RepoRef, opts CreateRepoOptions) error {
+	req := repoCreateRequest{Name: ref.Repo, Organization: ref.Author, Type: repoTypeField(ref), Private: opts.Private}
+	if ref.Type == SpaceType {
+		if opts.SpaceSDK == "" {
+			return errors.New("SpaceSDK is required to create a Space")
+		}
+		req.SDK = opts.SpaceSDK
+	}
+	err := c.sendJSON(ctx, "POST", c.serverBase+"/api/repos/create", nil, &req, nil)
+	if opts.ExistOK && errors.Is(err, ErrConflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", ref.RepoID(), err)
+	}
+	return nil
+}
+
+// https://huggingface.co/docs/hub/api#delete-apireposdelete
+type repoDeleteRequest struct {
+	Name         string `json:"name"`
+	Organization string `json:"organization"`
+	Type         string `json:"type,omitempty"`
+}
+
+// DeleteRepo deletes the repository on the Hub. This cannot be undone.
+func (c *Client) DeleteRepo(ctx context.Context, ref RepoRef) error {
+	req := repoDeleteRequest{Name: ref.Repo, Organization: ref.Author, Type: repoTypeField(ref)}
+	if err := c.sendJSON(ctx, "DELETE", c.serverBase+"/api/repos/delete", nil, &req, nil); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", ref.RepoID(), err)
+	}
+	return nil
+}
+
+// https://huggingface.co/docs/hub/api#post-apireposmove
+type repoMoveRequest struct {
+	FromRepo string `json:"fromRepo"`
+	ToRepo   string `json:"toRepo"`
+	Type     string `json:"type,omitempty"`
+}
+
+// MoveRepo renames the repository from, possibly to another user or
+// organization. Both must be of the same type.
+//
+// It returns an error matching ErrConflict if to already exists.
+func (c *Client) MoveRepo(ctx context.Context, from, to RepoRef) error {
+	if repoTypeField(from) != repoTypeField(to) {
+		return fmt.Errorf("cannot move a %s to a %s", from.apiPath(), to.apiPath())
+	}
+	req := repoMoveRequest{FromRepo: from.RepoID(), ToRepo: to.RepoID(), Type: repoTypeField(from)}
+	if err := c.sendJSON(ctx, "POST", c.serverBase+"/api/repos/move", nil, &req, nil); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", from.RepoID(), to.RepoID(), err)
+	}
+	return nil
+}
+
+// https://huggingface.co/docs/hub/api#put-apireposrepotyperepoidsettings
+type repoSettingsRequest struct {
+	Private             *bool `json:"private,omitempty"`
+	Gated               any   `json:"gated,omitempty"`
+	DiscussionsDisabled *bool `json:"discussionsDisabled,omitempty"`
+}
+
+// UpdateRepoSettings changes the settings of the repository.
+func (c *Client) UpdateRepoSettings(ctx context.Context, ref RepoRef, s RepoSettings) error {
+	req := repoSettingsRequest{Private: s.Private, DiscussionsDisabled: s.DiscussionsDisabled}
+	if s.Gated != nil {
+		switch *s.Gated {
+		case GatedNone:
+			req.Gated = false
+		case GatedAuto, GatedManual:
+			req.Gated = string(*s.Gated)
+		default:
+			return fmt.Errorf("invalid gated mode %q", *s.Gated)
+		}
+	}
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/settings"
+	if err := c.sendJSON(ctx, "PUT", u, nil, &req, nil); err != nil {
+		return fmt.Errorf("failed to update the settings of %s: %w", ref.RepoID(), err)
+	}
+	return nil
+}
+
+type repoDuplicateRequest struct {
+	Repository string `json:"repository"`
+	Private    bool   `json:"private"`
+}
+
+// DuplicateRepo copies the Space from, including its history, to the new
+// Space to.
+//
+// Only Spaces can be duplicated, the Hub has no such API for models and
+// datasets. It returns an error matching ErrConflict if to already exists.
+func (c *Client) DuplicateRepo(ctx context.Context, from, to RepoRef, private bool) error {
+	if from.Type != SpaceType || to.Type != SpaceType {
+		return fmt.Errorf("cannot duplicate a %s to a %s, only spaces can be duplicated", from.apiPath(), to.apiPath())
+	}
+	req := repoDuplicateRequest{Repository: to.RepoID(), Private: private}
+	u := c.serverBase + "/api/" + from.apiPath() + "/" + from.RepoID() + "/duplicate"
+	if err := c.sendJSON(ctx, "POST", u, nil, &req, nil); err != nil {
+		return fmt.Errorf("failed to duplicate %s to %s: %w", from.RepoID(), to.RepoID(), err)
+	}
+	return nil
+}
+
+// repoTypeField returns the value of the "type" field of the repository
+// management API, which is empty for models.
+func repoTypeField(ref RepoRef) string {
+	if ref.Type == ModelType {
+		return ""
+	}
+	return string(ref.Type)
+}
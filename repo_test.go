@@ -0,0 +1,98 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRepoManagement(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, r.Method+" "+r.URL.Path+" "+string(b))
+		if r.URL.Path == "/api/repos/create" && string(b) == `{"name":"taken","organization":"a","private":false}` {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":"You already created this model repo","url":"https://huggingface.co/a/taken"}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	c, err := New("hf_secret", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	model := RepoRef{Type: ModelType, Author: "a", Repo: "b"}
+	space := RepoRef{Type: SpaceType, Author: "a", Repo: "s"}
+	if err = c.CreateRepo(ctx, model, CreateRepoOptions{Private: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CreateRepo(ctx, space, CreateRepoOptions{}); err == nil {
+		t.Fatal("expected error without SpaceSDK")
+	}
+	if err = c.CreateRepo(ctx, space, CreateRepoOptions{SpaceSDK: "docker"}); err != nil {
+		t.Fatal(err)
+	}
+	taken := RepoRef{Author: "a", Repo: "taken"}
+	err = c.CreateRepo(ctx, taken, CreateRepoOptions{})
+	var herr *HubError
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &herr) || herr.Message != "You already created this model repo" {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if err = c.CreateRepo(ctx, taken, CreateRepoOptions{ExistOK: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.MoveRepo(ctx, model, RepoRef{Author: "org", Repo: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.MoveRepo(ctx, model, space); err == nil {
+		t.Fatal("expected error")
+	}
+	private := false
+	gated := GatedNone
+	if err = c.UpdateRepoSettings(ctx, model, RepoSettings{Private: &private, Gated: &gated}); err != nil {
+		t.Fatal(err)
+	}
+	gated = GatedManual
+	if err = c.UpdateRepoSettings(ctx, space, RepoSettings{Gated: &gated}); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DuplicateRepo(ctx, space, RepoRef{Type: SpaceType, Author: "me", Repo: "s"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DuplicateRepo(ctx, model, RepoRef{Author: "me", Repo: "b"}, true); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = c.DuplicateRepo(ctx, space, RepoRef{Author: "me", Repo: "s"}, true); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = c.DeleteRepo(ctx, RepoRef{Type: DatasetType, Author: "a", Repo: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`POST /api/repos/create {"name":"b","organization":"a","private":true}`,
+		`POST /api/repos/create {"name":"s","organization":"a","type":"space","private":false,"sdk":"docker"}`,
+		`POST /api/repos/create {"name":"taken","organization":"a","private":false}`,
+		`POST /api/repos/create {"name":"taken","organization":"a","private":false}`,
+		`POST /api/repos/move {"fromRepo":"a/b","toRepo":"org/b"}`,
+		`PUT /api/models/a/b/settings {"private":false,"gated":false}`,
+		`PUT /api/spaces/a/s/settings {"gated":"manual"}`,
+		`POST /api/spaces/a/s/duplicate {"repository":"me/s","private":true}`,
+		`DELETE /api/repos/delete {"name":"d","organization":"a","type":"dataset"}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
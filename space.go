@@ -0,0 +1,116 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Space is a Space application stored on https://huggingface.co
+type Space struct {
+	RepoRef
+
+	// Information filled by GetSpaceInfo():
+
+	// SDK is the SDK used by the Space, e.g. "gradio", "streamlit", "docker"
+	// or "static".
+	SDK string
+	// Hardware is the hardware the Space currently runs on, e.g. "cpu-basic".
+	// It is empty when the Space is not running.
+	Hardware string
+	// RequestedHardware is the hardware requested by the Space's owner.
+	RequestedHardware string
+	// Stage is the runtime stage of the Space, e.g. "RUNNING", "SLEEPING",
+	// "BUILDING" or "RUNTIME_ERROR".
+	Stage string
+	// Tags is the list of tags of the Space.
+	Tags []string
+	// Likes is the number of likes.
+	Likes int64
+	// Files is the list of files in the repository.
+	Files []string
+	// Created is the time the repository was created.
+	Created time.Time
+	// Modified is the last time the repository was modified.
+	Modified time.Time
+	// SHA of the reference requested.
+	SHA string
+
+	_ struct{}
+}
+
+// https://huggingface.co/docs/hub/api#get-apispacesrepoid-or-apispacesrepoidrevisionrevision
+type spaceInfoResponse struct {
+	HiddenID     string         `json:"_id"`
+	ID           string         `json:"id"`
+	Author       string         `json:"author"`
+	SHA          string         `json:"sha"`
+	CardData     map[string]any `json:"cardData"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	Disabled     bool           `json:"disabled"`
+	Gated        any            `json:"gated"`
+	Host         string         `json:"host"`
+	LastModified time.Time      `json:"lastModified"`
+	Likes        int64          `json:"likes"`
+	Private      bool           `json:"private"`
+	Runtime      struct {
+		Stage    string `json:"stage"`
+		Hardware struct {
+			Current   string `json:"current"`
+			Requested string `json:"requested"`
+		} `json:"hardware"`
+	} `json:"runtime"`
+	SDK      string `json:"sdk"`
+	Siblings []struct {
+		Filename string `json:"rfilename"`
+	} `json:"siblings"`
+	Subdomain   string   `json:"subdomain"`
+	Tags        []string `json:"tags"`
+	UsedStorage int64    `json:"usedStorage"`
+}
+
+// GetSpaceInfo fills the supplied Space with information from the HuggingFace
+// Hub.
+//
+// Use "main" as ref unless you need a specific commit.
+func (c *Client) GetSpaceInfo(ctx context.Context, s *Space, ref string) error {
+	s.Type = SpaceType
+	slog.Info("hf", "space", s.RepoID())
+	url := c.serverBase + "/api/spaces/" + s.RepoID() + "/revision/" + escapeRevision(ref)
+	resp, err := c.request(ctx, c.h, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list space %s: %w", s.RepoID(), err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// Like datasets, unknown fields are ignored.
+	r := spaceInfoResponse{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		slog.Error("hf", "space", s.RepoID(), "data", string(b))
+		return fmt.Errorf("failed to parse space %s response: %w", s.RepoID(), err)
+	}
+	s.SDK = r.SDK
+	s.Hardware = r.Runtime.Hardware.Current
+	s.RequestedHardware = r.Runtime.Hardware.Requested
+	s.Stage = r.Runtime.Stage
+	s.Tags = r.Tags
+	s.Likes = r.Likes
+	s.Files = make([]string, len(r.Siblings))
+	for i := range r.Siblings {
+		s.Files[i] = r.Siblings[i].Filename
+	}
+	s.Created = r.CreatedAt
+	s.Modified = r.LastModified
+	s.SHA = r.SHA
+	return nil
+}
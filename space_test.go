@@ -0,0 +1,93 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestGetSpaceInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/spaces/gradio/hello_world/revision/main" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		w.Write([]byte(apiSpaceHelloData))
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Space{RepoRef: RepoRef{Author: "gradio", Repo: "hello_world"}}
+	if err := c.GetSpaceInfo(context.Background(), &got, "main"); err != nil {
+		t.Fatal(err)
+	}
+	want := Space{
+		RepoRef:           RepoRef{Type: SpaceType, Author: "gradio", Repo: "hello_world"},
+		SDK:               "gradio",
+		Hardware:          "cpu-basic",
+		RequestedHardware: "cpu-basic",
+		Stage:             "RUNNING",
+		Tags:              []string{"gradio", "region:us"},
+		Likes:             12,
+		Files:             []string{"README.md", "app.py", "requirements.txt"},
+		Created:           time.Date(2022, 4, 1, 10, 0, 0, 0, time.UTC),
+		Modified:          time.Date(2024, 10, 1, 18, 30, 0, 0, time.UTC),
+		SHA:               "95ba6b4b3e8f2f0aab0e3e0cc1ea5da8a1c0c2a1",
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(want, RepoRef{})); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+const apiSpaceHelloData = `{
+  "_id": "6246cd0d3f1d3f0b9a7d8b1e",
+  "id": "gradio/hello_world",
+  "author": "gradio",
+  "sha": "95ba6b4b3e8f2f0aab0e3e0cc1ea5da8a1c0c2a1",
+  "lastModified": "2024-10-01T18:30:00.000Z",
+  "private": false,
+  "gated": false,
+  "disabled": false,
+  "host": "https://gradio-hello-world.hf.space",
+  "subdomain": "gradio-hello-world",
+  "likes": 12,
+  "sdk": "gradio",
+  "tags": ["gradio", "region:us"],
+  "runtime": {
+    "stage": "RUNNING",
+    "hardware": {"current": "cpu-basic", "requested": "cpu-basic"},
+    "storage": null,
+    "gcTimeout": 172800,
+    "replicas": {"current": 1, "requested": 1}
+  },
+  "siblings": [
+    {"rfilename": "README.md"},
+    {"rfilename": "app.py"},
+    {"rfilename": "requirements.txt"}
+  ],
+  "createdAt": "2022-04-01T10:00:00.000Z",
+  "usedStorage": 1234
+}`
+
+func TestEnsureFile_Space(t *testing.T) {
+	ref := RepoRef{Type: SpaceType, Author: "author", Repo: "app"}
+	_, c := newFakeHubRepo(t, ref, map[string][]byte{"app.py": []byte("print('hi')\n")})
+	got, err := c.EnsureFile(context.Background(), ref, "main", "app.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(c.hubCacheDir, "spaces--author--app", "snapshots", fakeCommit, "app.py"); got != want {
+		t.Fatalf("unexpected path %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TreeEntry is a file or a directory in a repository.
+type TreeEntry struct {
+	// Path is the path of the entry relative to the repository root.
+	Path string
+	// Type is either "file" or "directory".
+	Type string
+	// Size is the size of the file in bytes. For LFS files, it is the size of
+	// the actual content, not the pointer.
+	Size int64
+	// BlobID is the git object ID of the entry. For LFS files, it is the ID of
+	// the pointer file.
+	BlobID string
+	// LFS is set when the file is stored in LFS.
+	LFS *LFSInfo `json:",omitempty"`
+	// XetHash is set when the file is stored on the Xet backend.
+	XetHash string `json:",omitempty"`
+	// LastCommit is the last commit that modified the entry. It is only set
+	// when ListRepoTreeOptions.Expand is true.
+	LastCommit *LastCommit `json:",omitempty"`
+}
+
+// IsDir returns true if the entry is a directory.
+func (t *TreeEntry) IsDir() bool {
+	return t.Type == "directory"
+}
+
+// LFSInfo is the information about a file stored in LFS.
+type LFSInfo struct {
+	// SHA256 is the hex encoded sha256 of the content. It is the etag used as
+	// the blob name in the cache.
+	SHA256 string
+	// Size is the size of the content in bytes.
+	Size int64
+	// PointerSize is the size of the LFS pointer file stored in git.
+	PointerSize int64
+}
+
+// LastCommit is the summary of the last commit that modified a file.
+type LastCommit struct {
+	// ID is the commit hash.
+	ID string
+	// Title is the first line of the commit message.
+	Title string
+	// Date is the time of the commit.
+	Date time.Time
+}
+
+// ListRepoTreeOptions controls ListRepoTree.
+type ListRepoTreeOptions struct {
+	// Recursive lists the content of the subdirectories.
+	Recursive bool
+	// Expand fills TreeEntry.LastCommit. It is significantly slower.
+	Expand bool
+}
+
+// https://huggingface.co/docs/hub/api#get-apimodelsrepoidtreerevisionpath
+type treeEntryResponse struct {
+	Type string `json:"type"`
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+	Path string `json:"path"`
+	LFS  *struct {
+		OID         string `json:"oid"`
+		Size        int64  `json:"size"`
+		PointerSize int64  `json:"pointerSize"`
+	} `json:"lfs"`
+	XetHash    string `json:"xetHash"`
+	LastCommit *struct {
+		ID    string    `json:"id"`
+		Title string    `json:"title"`
+		Date  time.Time `json:"date"`
+	} `json:"lastCommit"`
+}
+
+// ListRepoTree lists the files and directories at path in the repository at
+// the revision. Use an empty path for the repository root.
+//
+// The results are fetched lazily one page at a time. Iteration stops after the
+// first error.
+func (c *Client) ListRepoTree(ctx context.Context, ref RepoRef, revision, path string, opts ListRepoTreeOptions) iter.Seq2[TreeEntry, error] {
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/tree/" + url.PathEscape(revision)
+	if path = strings.Trim(path, "/"); path != "" {
+		u += "/" + path
+	}
+	v := url.Values{}
+	if opts.Recursive {
+		v.Set("recursive", "true")
+	}
+	if opts.Expand {
+		v.Set("expand", "true")
+	}
+	if len(v) != 0 {
+		u += "?" + v.Encode()
+	}
+	return func(yield func(TreeEntry, error) bool) {
+		for r, err := range listPages[treeEntryResponse](ctx, c, u) {
+			if err != nil {
+				yield(TreeEntry{}, err)
+				return
+			}
+			e := TreeEntry{Path: r.Path, Type: r.Type, Size: r.Size, BlobID: r.OID, XetHash: r.XetHash}
+			if r.LFS != nil {
+				e.LFS = &LFSInfo{SHA256: r.LFS.OID, Size: r.LFS.Size, PointerSize: r.LFS.PointerSize}
+			}
+			if r.LastCommit != nil {
+				e.LastCommit = &LastCommit{ID: r.LastCommit.ID, Title: r.LastCommit.Title, Date: r.LastCommit.Date}
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListRepoTree(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/datasets/a/b/tree/main/data" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("cursor") == "" {
+			if got := r.URL.RawQuery; got != "expand=true&recursive=true" {
+				t.Errorf("unexpected query %s", got)
+			}
+			w.Header().Set("Link", "<"+server.URL+r.URL.Path+"?cursor=x>; rel=\"next\"")
+			w.Write([]byte(`[
+				{"type":"directory","oid":"1111111111111111111111111111111111111111","size":0,"path":"data/sub"},
+				{"type":"file","oid":"2222222222222222222222222222222222222222","size":20,"path":"data/sub/a.txt",
+				 "lastCommit":{"id":"3333333333333333333333333333333333333333","title":"Add a","date":"2024-01-02T03:04:05.000Z"}}
+			]`))
+			return
+		}
+		w.Write([]byte(`[
+			{"type":"file","oid":"4444444444444444444444444444444444444444","size":1000,"path":"data/b.parquet",
+			 "lfs":{"oid":"5555555555555555555555555555555555555555555555555555555555555555","size":1000,"pointerSize":134},
+			 "xetHash":"6666666666666666666666666666666666666666666666666666666666666666"}
+		]`))
+	}))
+	defer server.Close()
+	c, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := RepoRef{Type: DatasetType, Author: "a", Repo: "b"}
+	var got []TreeEntry
+	for e, err := range c.ListRepoTree(context.Background(), ref, "main", "/data/", ListRepoTreeOptions{Recursive: true, Expand: true}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	want := []TreeEntry{
+		{Path: "data/sub", Type: "directory", BlobID: "1111111111111111111111111111111111111111"},
+		{
+			Path: "data/sub/a.txt", Type: "file", Size: 20, BlobID: "2222222222222222222222222222222222222222",
+			LastCommit: &LastCommit{ID: "3333333333333333333333333333333333333333", Title: "Add a", Date: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{
+			Path: "data/b.parquet", Type: "file", Size: 1000, BlobID: "4444444444444444444444444444444444444444",
+			LFS:     &LFSInfo{SHA256: "5555555555555555555555555555555555555555555555555555555555555555", Size: 1000, PointerSize: 134},
+			XetHash: "6666666666666666666666666666666666666666666666666666666666666666",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+	if !got[0].IsDir() || got[1].IsDir() {
+		t.Fatal("unexpected IsDir")
+	}
+}
@@ -0,0 +1,582 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// CommitOperation is a change in a commit created with CreateCommit.
+type CommitOperation struct {
+	// Path is the path of the file in the repository, using forward slashes.
+	Path string
+	// Delete deletes Path instead of adding it. When Path ends with "/", the
+	// whole folder is deleted.
+	Delete bool
+	// Source is the local file to upload to Path.
+	Source string
+	// Content is the content to upload to Path when Source is empty.
+	Content []byte
+
+	_ struct{}
+}
+
+// CommitOptions describes the commit created with CreateCommit.
+type CommitOptions struct {
+	// Revision is the branch to commit to. Defaults to "main".
+	Revision string
+	// Summary is the first line of the commit message. It is required by
+	// CreateCommit.
+	Summary string
+	// Description is the rest of the commit message.
+	Description string
+	// ParentCommit is the commit hash the branch is expected to point to. When
+	// set, the commit fails if the branch moved in the meantime.
+	ParentCommit string
+
+	_ struct{}
+}
+
+// CommitInfo is a commit created on the Hub.
+type CommitInfo struct {
+	// SHA is the hash of the new commit.
+	SHA string
+	// URL is the URL of the commit on the Hub.
+	URL string
+
+	_ struct{}
+}
+
+// CreateCommit creates a commit on the repository with the add and delete
+// operations in ops.
+//
+// Files are first submitted to the Hub's preupload check, which decides which
+// ones are stored in LFS. These are uploaded through the LFS batch API,
+// concurrently up to c.Concurrency, skipping the ones the Hub already has.
+// The other files are sent inline with the commit.
+//
+// Similar to
+// https://huggingface.co/docs/huggingface_hub/package_reference/hf_api#huggingface_hub.HfApi.create_commit
+func (c *Client) CreateCommit(ctx context.Context, ref RepoRef, ops []CommitOperation, opts CommitOptions) (*CommitInfo, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("no operation to commit")
+	}
+	if opts.Summary == "" {
+		return nil, errors.New("a commit summary is required")
+	}
+	if opts.Revision == "" {
+		opts.Revision = "main"
+	}
+	if err := checkRevision(opts.Revision); err != nil {
+		return nil, err
+	}
+	if opts.ParentCommit != "" && !reSHA1.MatchString(opts.ParentCommit) {
+		return nil, fmt.Errorf("parent commit %q is not a commit hash", opts.ParentCommit)
+	}
+	var files []*uploadFile
+	for i := range ops {
+		op := &ops[i]
+		if op.Delete {
+			if err := checkRepoPath(strings.TrimSuffix(op.Path, "/"), true); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := checkRepoPath(op.Path, false); err != nil {
+			return nil, err
+		}
+		if op.Source != "" && op.Content != nil {
+			return nil, fmt.Errorf("%q: Source and Content are mutually exclusive", op.Path)
+		}
+		u, err := hashUploadFile(op)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, u)
+	}
+	for b := range slices.Chunk(files, lfsBatchSize) {
+		if err := c.preupload(ctx, ref, opts.Revision, b); err != nil {
+			return nil, err
+		}
+	}
+	var lfs []*uploadFile
+	for _, u := range files {
+		if u.lfs && !u.ignored {
+			lfs = append(lfs, u)
+		}
+	}
+	for b := range slices.Chunk(lfs, lfsBatchSize) {
+		if err := c.uploadLFS(ctx, ref, opts.Revision, b); err != nil {
+			return nil, err
+		}
+	}
+	return c.commit(ctx, ref, ops, files, opts)
+}
+
+// UploadFile uploads the local file src to path in the repository.
+//
+// The commit summary defaults to "Upload <path>".
+func (c *Client) UploadFile(ctx context.Context, ref RepoRef, src, path string, opts CommitOptions) (*CommitInfo, error) {
+	if opts.Summary == "" {
+		opts.Summary = "Upload " + path
+	}
+	return c.CreateCommit(ctx, ref, []CommitOperation{{Path: path, Source: src}}, opts)
+}
+
+// UploadFolder uploads the files in the local directory dir matching any of
+// the globs into path in the repository, in a single commit. All files are
+// uploaded if glob is empty. Use an empty path to upload to the root of the
+// repository. The .git directory is skipped.
+//
+// The commit summary defaults to "Upload folder".
+func (c *Client) UploadFolder(ctx context.Context, ref RepoRef, dir, path string, glob []string, opts CommitOptions) (*CommitInfo, error) {
+	var all []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		all = append(all, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	desired, err := matchGlobs(all, glob)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]CommitOperation, len(desired))
+	for i, f := range desired {
+		ops[i].Source = filepath.Join(dir, filepath.FromSlash(f))
+		ops[i].Path = f
+		if path != "" {
+			ops[i].Path = strings.TrimSuffix(path, "/") + "/" + f
+		}
+	}
+	if opts.Summary == "" {
+		opts.Summary = "Upload folder"
+	}
+	return c.CreateCommit(ctx, ref, ops, opts)
+}
+
+// lfsBatchSize is the maximum number of files per preupload and LFS batch
+// request.
+const lfsBatchSize = 256
+
+// uploadFile is a file to add in a commit.
+type uploadFile struct {
+	op     *CommitOperation
+	size   int64
+	sha256 string
+	// sample is the beginning of the content, used by the Hub to decide if the
+	// file is stored in LFS.
+	sample []byte
+	// lfs is set by the preupload check.
+	lfs bool
+	// ignored is set by the preupload check when the file matches the
+	// repository's .gitignore.
+	ignored bool
+}
+
+// uploadSource is the content of a file to upload.
+type uploadSource interface {
+	io.ReaderAt
+	io.Closer
+}
+
+type bytesSource struct {
+	*bytes.Reader
+}
+
+func (bytesSource) Close() error {
+	return nil
+}
+
+// open returns the content to upload.
+func (u *uploadFile) open() (uploadSource, error) {
+	if u.op.Source == "" {
+		return bytesSource{bytes.NewReader(u.op.Content)}, nil
+	}
+	return os.Open(u.op.Source)
+}
+
+// hashUploadFile returns the size, sha256 and sample of the content of op.
+func hashUploadFile(op *CommitOperation) (*uploadFile, error) {
+	u := &uploadFile{op: op, size: int64(len(op.Content))}
+	if op.Source != "" {
+		fi, err := os.Stat(op.Source)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%q is not a file", op.Source)
+		}
+		u.size = fi.Size()
+	}
+	src, err := u.open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, io.NewSectionReader(src, 0, u.size)); err != nil {
+		return nil, fmt.Errorf("failed to hash %q: %w", op.Path, err)
+	}
+	u.sha256 = hex.EncodeToString(h.Sum(nil))
+	u.sample = make([]byte, min(u.size, 512))
+	if _, err = io.ReadFull(io.NewSectionReader(src, 0, u.size), u.sample); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", op.Path, err)
+	}
+	return u, nil
+}
+
+// checkRepoPath returns an error if p is not a valid path in a repository.
+func checkRepoPath(p string, isDelete bool) error {
+	if p == "" && isDelete {
+		return errors.New("refusing to delete the whole repository")
+	}
+	if p == "" || strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return fmt.Errorf("invalid path %q", p)
+	}
+	for _, s := range strings.Split(p, "/") {
+		if s == "" || s == "." || s == ".." {
+			return fmt.Errorf("invalid path %q", p)
+		}
+	}
+	return nil
+}
+
+// https://huggingface.co/docs/hub/api#post-apimodelsrepoidpreuploadrevision
+type preuploadRequest struct {
+	Files []preuploadFile `json:"files"`
+}
+
+type preuploadFile struct {
+	Path   string `json:"path"`
+	Sample string `json:"sample"`
+	Size   int64  `json:"size"`
+}
+
+type preuploadResponse struct {
+	Files []struct {
+		Path         string `json:"path"`
+		UploadMode   string `json:"uploadMode"`
+		ShouldIgnore bool   `json:"shouldIgnore"`
+	} `json:"files"`
+}
+
+// preupload asks the Hub which files must be uploaded through LFS.
+func (c *Client) preupload(ctx context.Context, ref RepoRef, revision string, files []*uploadFile) error {
+	req := preuploadRequest{Files: make([]preuploadFile, len(files))}
+	byPath := make(map[string]*uploadFile, len(files))
+	for i, u := range files {
+		req.Files[i] = preuploadFile{Path: u.op.Path, Sample: base64.StdEncoding.EncodeToString(u.sample), Size: u.size}
+		byPath[u.op.Path] = u
+	}
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/preupload/" + escapeRevision(revision)
+	resp := preuploadResponse{}
+	if err := c.queryJSON(ctx, u, nil, &req, &resp); err != nil {
+		return fmt.Errorf("preupload check failed: %w", err)
+	}
+	for _, f := range resp.Files {
+		if uf := byPath[f.Path]; uf != nil {
+			uf.lfs = f.UploadMode == "lfs"
+			if uf.ignored = f.ShouldIgnore; uf.ignored {
+				slog.Warn("hf", "message", "skipping file ignored by .gitignore", "path", f.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// lfsHeaders are the headers for the LFS batch API.
+//
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md
+var lfsHeaders = map[string]string{
+	"Accept":       "application/vnd.git-lfs+json",
+	"Content-Type": "application/vnd.git-lfs+json",
+}
+
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []lfsObject `json:"objects"`
+	HashAlgo  string      `json:"hash_algo"`
+	Ref       struct {
+		Name string `json:"name"`
+	} `json:"ref"`
+}
+
+type lfsObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type lfsBatchResponse struct {
+	Transfer string `json:"transfer"`
+	Objects  []struct {
+		OID     string `json:"oid"`
+		Size    int64  `json:"size"`
+		Actions struct {
+			Upload *lfsAction `json:"upload"`
+			Verify *lfsAction `json:"verify"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+type lfsCompletion struct {
+	OID   string              `json:"oid"`
+	Parts []lfsCompletionPart `json:"parts"`
+}
+
+type lfsCompletionPart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+// uploadLFS uploads the files to the LFS storage, skipping the ones already
+// present.
+func (c *Client) uploadLFS(ctx context.Context, ref RepoRef, revision string, files []*uploadFile) error {
+	req := lfsBatchRequest{Operation: "upload", Transfers: []string{"basic", "multipart"}, HashAlgo: "sha256"}
+	req.Ref.Name = revision
+	byOID := map[string]*uploadFile{}
+	for _, u := range files {
+		if byOID[u.sha256] == nil {
+			byOID[u.sha256] = u
+			req.Objects = append(req.Objects, lfsObject{OID: u.sha256, Size: u.size})
+		}
+	}
+	u := c.serverBase + "/" + ref.urlPrefix() + ref.RepoID() + ".git/info/lfs/objects/batch"
+	resp := lfsBatchResponse{}
+	if err := c.queryJSON(ctx, u, lfsHeaders, &req, &resp); err != nil {
+		return fmt.Errorf("LFS batch request failed: %w", err)
+	}
+	for _, o := range resp.Objects {
+		if f := byOID[o.OID]; f == nil {
+			return fmt.Errorf("LFS batch returned unexpected object %s", o.OID)
+		} else if o.Error != nil {
+			return fmt.Errorf("failed to upload %q: LFS error %d: %s", f.op.Path, o.Error.Code, o.Error.Message)
+		}
+	}
+	eg, ctx2 := errgroup.WithContext(ctx)
+	eg.SetLimit(max(c.Concurrency, 1))
+	for _, o := range resp.Objects {
+		f := byOID[o.OID]
+		if o.Actions.Upload == nil {
+			// The content is already stored.
+			slog.Info("hf", "message", "already uploaded", "path", f.op.Path)
+			continue
+		}
+		eg.Go(func() error {
+			if err := c.uploadLFSObject(ctx2, f, o.Actions.Upload); err != nil {
+				return fmt.Errorf("failed to upload %q: %w", f.op.Path, err)
+			}
+			if v := o.Actions.Verify; v != nil {
+				hdr := maps.Clone(lfsHeaders)
+				maps.Copy(hdr, v.Header)
+				if err := c.sendJSON(ctx2, "POST", v.Href, hdr, &lfsObject{OID: f.sha256, Size: f.size}, nil); err != nil {
+					return fmt.Errorf("failed to verify %q: %w", f.op.Path, err)
+				}
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// uploadLFSObject uploads the content of f with the upload action returned by
+// the LFS batch API.
+//
+// The content is uploaded in parts when the action has a chunk size, in a
+// single request otherwise. The URLs are presigned so no token is sent.
+func (c *Client) uploadLFSObject(ctx context.Context, f *uploadFile, upload *lfsAction) error {
+	src, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, ok := upload.Header["chunk_size"]; !ok {
+		resp, err := c.requestToken(ctx, c.h, "PUT", upload.Href, "", upload.Header, c.throttleSeeker(ctx, io.NewSectionReader(src, 0, f.size)), true)
+		if err != nil {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.Body.Close()
+	}
+
+	// The header contains the chunk size and the presigned URL of each part,
+	// keyed by part number.
+	chunkSize, err := strconv.ParseInt(upload.Header["chunk_size"], 10, 64)
+	if err != nil || chunkSize <= 0 {
+		return fmt.Errorf("invalid multipart chunk size %q", upload.Header["chunk_size"])
+	}
+	var parts []string
+	for k := range upload.Header {
+		if _, err := strconv.Atoi(k); err == nil {
+			parts = append(parts, k)
+		}
+	}
+	slices.SortFunc(parts, func(a, b string) int {
+		i, _ := strconv.Atoi(a)
+		j, _ := strconv.Atoi(b)
+		return i - j
+	})
+	if want := (f.size + chunkSize - 1) / chunkSize; int64(len(parts)) != want {
+		return fmt.Errorf("expected %d multipart URLs, got %d", want, len(parts))
+	}
+	done := lfsCompletion{OID: f.sha256, Parts: make([]lfsCompletionPart, len(parts))}
+	for i, k := range parts {
+		start := int64(i) * chunkSize
+		r := io.NewSectionReader(src, start, min(chunkSize, f.size-start))
+		resp, err := c.requestToken(ctx, c.h, "PUT", upload.Header[k], "", nil, c.throttleSeeker(ctx, r), true)
+		if err != nil {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		etag := resp.Header.Get("Etag")
+		if etag == "" {
+			return fmt.Errorf("part %d has no etag", i+1)
+		}
+		done.Parts[i] = lfsCompletionPart{PartNumber: i + 1, ETag: etag}
+	}
+	return c.sendJSON(ctx, "POST", upload.Href, lfsHeaders, &done, nil)
+}
+
+type commitLine struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type commitHeader struct {
+	Summary      string `json:"summary"`
+	Description  string `json:"description"`
+	ParentCommit string `json:"parentCommit,omitempty"`
+}
+
+type commitFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+type commitLFSFile struct {
+	Path string `json:"path"`
+	Algo string `json:"algo"`
+	OID  string `json:"oid"`
+}
+
+type commitDeleted struct {
+	Path string `json:"path"`
+}
+
+// https://huggingface.co/docs/hub/api#post-apimodelsrepoidcommitrevision
+type createCommitResponse struct {
+	Success   bool   `json:"success"`
+	CommitOID string `json:"commitOid"`
+	CommitURL string `json:"commitUrl"`
+}
+
+// commit sends the NDJSON commit payload.
+func (c *Client) commit(ctx context.Context, ref RepoRef, ops []CommitOperation, files []*uploadFile, opts CommitOptions) (*CommitInfo, error) {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	if err := e.Encode(commitLine{"header", commitHeader{opts.Summary, opts.Description, opts.ParentCommit}}); err != nil {
+		return nil, err
+	}
+	for i := range ops {
+		if op := &ops[i]; op.Delete {
+			key := "deletedFile"
+			if strings.HasSuffix(op.Path, "/") {
+				key = "deletedFolder"
+			}
+			if err := e.Encode(commitLine{key, commitDeleted{op.Path}}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, u := range files {
+		var l commitLine
+		switch {
+		case u.ignored:
+			continue
+		case u.lfs:
+			l = commitLine{"lfsFile", commitLFSFile{u.op.Path, "sha256", u.sha256}}
+		default:
+			src, err := u.open()
+			if err != nil {
+				return nil, err
+			}
+			b := make([]byte, u.size)
+			_, err = io.ReadFull(io.NewSectionReader(src, 0, u.size), b)
+			_ = src.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %q: %w", u.op.Path, err)
+			}
+			l = commitLine{"file", commitFile{u.op.Path, base64.StdEncoding.EncodeToString(b), "base64"}}
+		}
+		if err := e.Encode(l); err != nil {
+			return nil, err
+		}
+	}
+	u := c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/commit/" + escapeRevision(opts.Revision)
+	resp, err := c.requestBody(ctx, c.h, "POST", u, map[string]string{"Content-Type": "application/x-ndjson"}, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	defer resp.Body.Close()
+	r := createCommitResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", u, err)
+	}
+	if !r.Success || r.CommitOID == "" {
+		return nil, fmt.Errorf("commit to %s@%s failed", ref.RepoID(), opts.Revision)
+	}
+	// The branch moved.
+	if err = c.invalidateRef(ref, "refs/heads/", opts.Revision); err != nil {
+		return nil, err
+	}
+	return &CommitInfo{SHA: r.CommitOID, URL: r.CommitURL}, nil
+}
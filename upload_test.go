@@ -0,0 +1,277 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeUploadHub implements the server side of CreateCommit for the model
+// "a/b".
+type fakeUploadHub struct {
+	t      testing.TB
+	server *httptest.Server
+	// stored is the content of the LFS storage by sha256.
+	stored map[string][]byte
+
+	mu    sync.Mutex
+	parts map[string][][]byte
+	// commit is the NDJSON lines of the last commit.
+	commit []map[string]any
+}
+
+func (f *fakeUploadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method != "POST" && r.Method != "PUT" {
+		f.t.Errorf("unexpected method %s", r.Method)
+	}
+	if ua := r.Header.Get("User-Agent"); ua != "test/1.0" {
+		f.t.Errorf("unexpected user agent %q for %s", ua, r.URL.Path)
+	}
+	switch p := r.URL.Path; {
+	case p == "/api/models/a/b/preupload/main":
+		req := preuploadRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error(err)
+		}
+		resp := map[string]any{}
+		var files []map[string]any
+		for _, fl := range req.Files {
+			mode := "regular"
+			if fl.Size > 16 {
+				mode = "lfs"
+			}
+			files = append(files, map[string]any{"path": fl.Path, "uploadMode": mode, "shouldIgnore": fl.Path == "ignored.txt"})
+		}
+		resp["files"] = files
+		_ = json.NewEncoder(w).Encode(resp)
+	case p == "/a/b.git/info/lfs/objects/batch":
+		if r.Header.Get("Content-Type") != "application/vnd.git-lfs+json" {
+			f.t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		req := lfsBatchRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error(err)
+		}
+		var objects []map[string]any
+		for _, o := range req.Objects {
+			obj := map[string]any{"oid": o.OID, "size": o.Size}
+			if _, ok := f.stored[o.OID]; !ok {
+				upload := map[string]any{"href": f.server.URL + "/basic/" + o.OID}
+				if o.Size > 100 {
+					// Use multipart uploads with 64 bytes parts.
+					hdr := map[string]string{"chunk_size": "64"}
+					for i := int64(0); i < (o.Size+63)/64; i++ {
+						hdr[fmt.Sprintf("%05d", i+1)] = fmt.Sprintf("%s/part/%s/%d", f.server.URL, o.OID, i)
+					}
+					upload = map[string]any{"href": f.server.URL + "/complete/" + o.OID, "header": hdr}
+				}
+				obj["actions"] = map[string]any{
+					"upload": upload,
+					"verify": map[string]any{"href": f.server.URL + "/verify/" + o.OID},
+				}
+			}
+			objects = append(objects, obj)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"transfer": "multipart", "objects": objects})
+	case strings.HasPrefix(p, "/basic/"), strings.HasPrefix(p, "/part/"):
+		if a := r.Header.Get("Authorization"); a != "" {
+			f.t.Errorf("token sent to presigned URL: %q", a)
+		}
+		if r.ContentLength < 0 {
+			f.t.Error("chunked upload")
+		}
+		b, _ := io.ReadAll(r.Body)
+		if oid, ok := strings.CutPrefix(p, "/basic/"); ok {
+			f.stored[oid] = b
+			return
+		}
+		oid, n, _ := strings.Cut(strings.TrimPrefix(p, "/part/"), "/")
+		i, err := strconv.Atoi(n)
+		if err != nil {
+			f.t.Error(err)
+		}
+		if f.parts[oid] == nil {
+			f.parts[oid] = make([][]byte, 100)
+		}
+		f.parts[oid][i] = b
+		w.Header().Set("Etag", fmt.Sprintf("\"etag%d\"", i))
+	case strings.HasPrefix(p, "/complete/"):
+		oid := strings.TrimPrefix(p, "/complete/")
+		req := lfsCompletion{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error(err)
+		}
+		var b []byte
+		for i, part := range req.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf("\"etag%d\"", i) {
+				f.t.Errorf("unexpected part %#v", part)
+			}
+			b = append(b, f.parts[oid][i]...)
+		}
+		f.stored[oid] = b
+	case strings.HasPrefix(p, "/verify/"):
+		oid := strings.TrimPrefix(p, "/verify/")
+		h := sha256.Sum256(f.stored[oid])
+		if hex.EncodeToString(h[:]) != oid {
+			http.Error(w, "corrupted", http.StatusBadRequest)
+		}
+	case p == "/api/models/a/b/commit/main":
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			f.t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		f.commit = nil
+		s := bufio.NewScanner(r.Body)
+		for s.Scan() {
+			l := map[string]any{}
+			if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+				f.t.Error(err)
+			}
+			f.commit = append(f.commit, l)
+		}
+		_, _ = w.Write([]byte(`{"success":true,"commitOid":"` + fakeCommit + `","commitUrl":"` + f.server.URL + `/a/b/commit/` + fakeCommit + `"}`))
+	default:
+		f.t.Errorf("unexpected path %s", p)
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeUploadHub(t testing.TB) (*fakeUploadHub, *Client) {
+	f := &fakeUploadHub{t: t, stored: map[string][]byte{}, parts: map[string][][]byte{}}
+	f.server = httptest.NewServer(f)
+	t.Cleanup(f.server.Close)
+	c, err := New("hf_secret", WithEndpoint(f.server.URL), WithHomeDir(t.TempDir()), WithUserAgent("test/1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, c
+}
+
+func TestCreateCommit(t *testing.T) {
+	f, c := newFakeUploadHub(t)
+	dir := t.TempDir()
+	small := []byte("{}")
+	medium := bytes.Repeat([]byte("m"), 50)
+	large := make([]byte, 1000)
+	for i := range large {
+		large[i] = byte(i * 13)
+	}
+	already := []byte("this content is already in LFS")
+	h := sha256.Sum256(already)
+	alreadyOID := hex.EncodeToString(h[:])
+	f.stored[alreadyOID] = already
+	if err := os.WriteFile(filepath.Join(dir, "model.bin"), large, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	ops := []CommitOperation{
+		{Path: "config.json", Content: small},
+		{Path: "medium.bin", Content: medium},
+		{Path: "dir/model.bin", Source: filepath.Join(dir, "model.bin")},
+		{Path: "copy.bin", Content: already},
+		{Path: "ignored.txt", Content: []byte("x")},
+		{Path: "old.bin", Delete: true},
+		{Path: "old/", Delete: true},
+	}
+	opts := CommitOptions{Summary: "Add model", Description: "Details", ParentCommit: strings.Repeat("a", 40)}
+	got, err := c.CreateCommit(context.Background(), RepoRef{Author: "a", Repo: "b"}, ops, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SHA != fakeCommit {
+		t.Fatal(got.SHA)
+	}
+	for _, b := range [][]byte{medium, large} {
+		h := sha256.Sum256(b)
+		if !bytes.Equal(f.stored[hex.EncodeToString(h[:])], b) {
+			t.Fatalf("LFS content mismatch")
+		}
+	}
+	oid := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+	want := []map[string]any{
+		{"key": "header", "value": map[string]any{"summary": "Add model", "description": "Details", "parentCommit": strings.Repeat("a", 40)}},
+		{"key": "deletedFile", "value": map[string]any{"path": "old.bin"}},
+		{"key": "deletedFolder", "value": map[string]any{"path": "old/"}},
+		{"key": "file", "value": map[string]any{"path": "config.json", "content": base64.StdEncoding.EncodeToString(small), "encoding": "base64"}},
+		{"key": "lfsFile", "value": map[string]any{"path": "medium.bin", "algo": "sha256", "oid": oid(medium)}},
+		{"key": "lfsFile", "value": map[string]any{"path": "dir/model.bin", "algo": "sha256", "oid": oid(large)}},
+		{"key": "lfsFile", "value": map[string]any{"path": "copy.bin", "algo": "sha256", "oid": alreadyOID}},
+	}
+	if diff := cmp.Diff(want, f.commit); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestCreateCommit_Invalid(t *testing.T) {
+	_, c := newFakeUploadHub(t)
+	ref := RepoRef{Author: "a", Repo: "b"}
+	data := []struct {
+		ops  []CommitOperation
+		opts CommitOptions
+	}{
+		{nil, CommitOptions{Summary: "s"}},
+		{[]CommitOperation{{Path: "a", Content: []byte("a")}}, CommitOptions{}},
+		{[]CommitOperation{{Path: "../a", Content: []byte("a")}}, CommitOptions{Summary: "s"}},
+		{[]CommitOperation{{Path: "/a", Content: []byte("a")}}, CommitOptions{Summary: "s"}},
+		{[]CommitOperation{{Path: "/", Delete: true}}, CommitOptions{Summary: "s"}},
+		{[]CommitOperation{{Path: "a", Source: "a", Content: []byte("a")}}, CommitOptions{Summary: "s"}},
+		{[]CommitOperation{{Path: "a", Content: []byte("a")}}, CommitOptions{Summary: "s", ParentCommit: "main"}},
+	}
+	for i, l := range data {
+		if _, err := c.CreateCommit(context.Background(), ref, l.ops, l.opts); err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestUploadFolder(t *testing.T) {
+	f, c := newFakeUploadHub(t)
+	dir := t.TempDir()
+	for _, n := range []string{"a.json", "sub/b.json", "c.txt", ".git/HEAD"} {
+		p := filepath.Join(dir, filepath.FromSlash(n))
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(n), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.UploadFolder(context.Background(), RepoRef{Author: "a", Repo: "b"}, dir, "cfg", []string{"*.json", "sub/*"}, CommitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range f.commit {
+		v := l["value"].(map[string]any)
+		if l["key"] == "header" {
+			got = append(got, v["summary"].(string))
+		} else {
+			got = append(got, v["path"].(string))
+		}
+	}
+	if diff := cmp.Diff([]string{"Upload folder", "cfg/a.json", "cfg/sub/b.json"}, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
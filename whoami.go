@@ -0,0 +1,142 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+)
+
+// User is the account the token belongs to, as returned by WhoAmI.
+type User struct {
+	// Name is the user name.
+	Name string
+	// FullName is the display name.
+	FullName string
+	// Email is the email address. It is only set when the token has the
+	// permission to read it.
+	Email string
+	// IsPro is true for PRO accounts.
+	IsPro bool
+	// Orgs are the organizations the user is a member of.
+	Orgs []Org
+	// Token is the information about the token used.
+	Token Token
+
+	_ struct{}
+}
+
+// Org is an organization the user is a member of.
+type Org struct {
+	// Name is the organization name.
+	Name string
+	// FullName is the display name.
+	FullName string
+	// Role is the role of the user in the organization, e.g. "read", "write"
+	// or "admin".
+	Role string
+
+	_ struct{}
+}
+
+// Token is the information about an access token.
+type Token struct {
+	// Name is the name given to the token when it was created.
+	Name string
+	// Role is "read", "write" or "fineGrained".
+	Role string
+	// CanReadGatedRepos is true when a fine-grained token can read the gated
+	// repositories the user has access to.
+	CanReadGatedRepos bool `json:",omitempty"`
+	// Global are the permissions granted by a fine-grained token on all of the
+	// user's resources, e.g. "discussion.write".
+	Global []string `json:",omitempty"`
+	// Scoped are the permissions granted by a fine-grained token on specific
+	// users, organizations or repositories.
+	Scoped []TokenScope `json:",omitempty"`
+
+	_ struct{}
+}
+
+// TokenScope is a set of permissions granted by a fine-grained token on an
+// entity.
+type TokenScope struct {
+	// Type is the type of entity, e.g. "user", "org", "model", "dataset" or
+	// "space".
+	Type string
+	// Name is the name of the entity.
+	Name string
+	// Permissions are the permissions granted, e.g. "repo.content.read".
+	Permissions []string
+
+	_ struct{}
+}
+
+// https://huggingface.co/docs/hub/api#get-apiwhoami-v2
+type whoAmIResponse struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	FullName string `json:"fullname"`
+	Email    string `json:"email"`
+	IsPro    bool   `json:"isPro"`
+	Orgs     []struct {
+		Name      string `json:"name"`
+		FullName  string `json:"fullname"`
+		RoleInOrg string `json:"roleInOrg"`
+	} `json:"orgs"`
+	Auth struct {
+		Type        string `json:"type"`
+		AccessToken struct {
+			DisplayName string `json:"displayName"`
+			Role        string `json:"role"`
+			FineGrained struct {
+				CanReadGatedRepos bool     `json:"canReadGatedRepos"`
+				Global            []string `json:"global"`
+				Scoped            []struct {
+					Entity struct {
+						Type string `json:"type"`
+						Name string `json:"name"`
+					} `json:"entity"`
+					Permissions []string `json:"permissions"`
+				} `json:"scoped"`
+			} `json:"fineGrained"`
+		} `json:"accessToken"`
+	} `json:"auth"`
+}
+
+// WhoAmI returns the account the token belongs to, along with the token's
+// role and permissions.
+//
+// It is a cheap way to confirm the token is valid before starting long
+// downloads.
+func (c *Client) WhoAmI(ctx context.Context) (*User, error) {
+	if c.token == "" {
+		return nil, errors.New("whoami requires a token")
+	}
+	r := whoAmIResponse{}
+	if _, err := c.getJSON(ctx, c.serverBase+"/api/whoami-v2", &r); err != nil {
+		return nil, err
+	}
+	at := &r.Auth.AccessToken
+	u := &User{
+		Name:     r.Name,
+		FullName: r.FullName,
+		Email:    r.Email,
+		IsPro:    r.IsPro,
+		Token: Token{
+			Name:              at.DisplayName,
+			Role:              at.Role,
+			CanReadGatedRepos: at.FineGrained.CanReadGatedRepos,
+			Global:            at.FineGrained.Global,
+		},
+	}
+	for _, o := range r.Orgs {
+		u.Orgs = append(u.Orgs, Org{Name: o.Name, FullName: o.FullName, Role: o.RoleInOrg})
+	}
+	for _, s := range at.FineGrained.Scoped {
+		u.Token.Scoped = append(u.Token.Scoped, TokenScope{Type: s.Entity.Type, Name: s.Entity.Name, Permissions: s.Permissions})
+	}
+	return u, nil
+}
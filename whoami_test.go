@@ -0,0 +1,115 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWhoAmI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/whoami-v2" {
+			t.Errorf("unexpected path, got: %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer hf_good" {
+			http.Error(w, "Invalid credentials in Authorization header", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(apiWhoAmIData))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	home := t.TempDir()
+	if _, err := New("hf_bad", WithEndpoint(server.URL), WithHomeDir(home), WithTokenCheck(ctx)); err == nil {
+		t.Fatal("expected error")
+	}
+	// The invalid token was not saved.
+	if _, err := os.Stat(filepath.Join(home, "token")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if _, err := New("", WithEndpoint(server.URL), WithHomeDir(t.TempDir()), WithTokenCheck(ctx)); err == nil {
+		t.Fatal("expected error")
+	}
+	ctx2, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := New("hf_good", WithEndpoint(server.URL), WithHomeDir(t.TempDir()), WithTokenCheck(ctx2)); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	c, err := New("hf_good", WithEndpoint(server.URL), WithHomeDir(home), WithTokenCheck(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(home, "token")); err != nil || string(b) != "hf_good" {
+		t.Fatalf("unexpected token file %q: %v", b, err)
+	}
+	got, err := c.WhoAmI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &User{
+		Name:     "alice",
+		FullName: "Alice",
+		IsPro:    true,
+		Orgs:     []Org{{Name: "acme", FullName: "ACME Corp", Role: "write"}},
+		Token: Token{
+			Name:              "ci",
+			Role:              "fineGrained",
+			CanReadGatedRepos: true,
+			Global:            []string{"discussion.write"},
+			Scoped: []TokenScope{
+				{Type: "org", Name: "acme", Permissions: []string{"repo.content.read", "repo.write"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(User{}, Org{}, Token{}, TokenScope{})); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+var apiWhoAmIData = `{
+  "type": "user",
+  "id": "5e67bd5b1009063689407478",
+  "name": "alice",
+  "fullname": "Alice",
+  "isPro": true,
+  "avatarUrl": "/avatars/alice.svg",
+  "orgs": [
+    {
+      "type": "org",
+      "id": "5e67bd5b1009063689407479",
+      "name": "acme",
+      "fullname": "ACME Corp",
+      "roleInOrg": "write",
+      "isEnterprise": false
+    }
+  ],
+  "auth": {
+    "type": "access_token",
+    "accessToken": {
+      "displayName": "ci",
+      "role": "fineGrained",
+      "createdAt": "2024-06-01T12:00:00.000Z",
+      "fineGrained": {
+        "canReadGatedRepos": true,
+        "global": ["discussion.write"],
+        "scoped": [
+          {
+            "entity": {"_id": "5e67bd5b1009063689407479", "type": "org", "name": "acme"},
+            "permissions": ["repo.content.read", "repo.write"]
+          }
+        ]
+      }
+    }
+  }
+}`
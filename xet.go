@@ -0,0 +1,478 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xetFile is the information needed to download a file stored on Xet, the
+// Hub's content addressed storage.
+//
+// See https://huggingface.co/docs/hub/storage-backends
+type xetFile struct {
+	// hash is the Xet hash of the file, which identifies it on the CAS server.
+	hash string
+	// refreshRoute is the Hub URL returning a token to access the CAS server.
+	refreshRoute string
+}
+
+// parseXetFile returns the Xet information advertised by the headers of the
+// Hub's response to a resolve request, or nil if the file is not stored on
+// Xet.
+func (c *Client) parseXetFile(h http.Header, ref RepoRef, commit string) *xetFile {
+	// The hash is used as a blob name, so it must be sane.
+	hash := h.Get("X-Xet-Hash")
+	if !reSHA256.MatchString(hash) {
+		return nil
+	}
+	x := &xetFile{hash: hash, refreshRoute: parseLink(h.Values("Link"), "xet-auth")}
+	if x.refreshRoute == "" {
+		x.refreshRoute = h.Get("X-Xet-Refresh-Route")
+	}
+	if x.refreshRoute == "" {
+		x.refreshRoute = c.xetRefreshRoute(ref, commit)
+	} else if strings.HasPrefix(x.refreshRoute, "/") {
+		x.refreshRoute = c.serverBase + x.refreshRoute
+	}
+	return x
+}
+
+// xetRefreshRoute returns the default Hub URL returning a token to read the
+// Xet files of the repository at the commit.
+func (c *Client) xetRefreshRoute(ref RepoRef, commit string) string {
+	return c.serverBase + "/api/" + ref.apiPath() + "/" + ref.RepoID() + "/xet-read-token/" + commit
+}
+
+// parseLink returns the URL of the relation rel in the Link headers, or an
+// empty string.
+func parseLink(values []string, rel string) string {
+	for _, v := range values {
+		for _, l := range strings.Split(v, ",") {
+			parts := strings.Split(l, ";")
+			u := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(u, "<") || !strings.HasSuffix(u, ">") {
+				continue
+			}
+			for _, p := range parts[1:] {
+				if k, val, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "rel" && strings.Trim(val, "\"") == rel {
+					return u[1 : len(u)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+type xetTokenResponse struct {
+	CasURL      string `json:"casUrl"`
+	AccessToken string `json:"accessToken"`
+	Exp         int64  `json:"exp"`
+}
+
+// getXetToken returns the CAS server URL and a token to access it.
+func (c *Client) getXetToken(ctx context.Context, refreshRoute string) (string, string, error) {
+	r := xetTokenResponse{}
+	hdr, err := c.getJSON(ctx, refreshRoute, &r)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get a Xet token: %w", err)
+	}
+	// The headers take precedence, like the python client.
+	if v := hdr.Get("X-Xet-Cas-Url"); v != "" {
+		r.CasURL = v
+	}
+	if v := hdr.Get("X-Xet-Access-Token"); v != "" {
+		r.AccessToken = v
+	}
+	if r.CasURL == "" || r.AccessToken == "" {
+		return "", "", errors.New("failed to get a Xet token: missing CAS URL or access token")
+	}
+	return strings.TrimRight(r.CasURL, "/"), r.AccessToken, nil
+}
+
+// xetRange is a range of chunks [Start, End), or a range of bytes [Start, End]
+// for URLRange.
+type xetRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// xetTerm is a range of chunks in a xorb.
+type xetTerm struct {
+	Hash           string   `json:"hash"`
+	UnpackedLength int64    `json:"unpacked_length"`
+	Range          xetRange `json:"range"`
+}
+
+// xetFetchInfo is where to download a range of chunks of a xorb.
+type xetFetchInfo struct {
+	Range    xetRange `json:"range"`
+	URL      string   `json:"url"`
+	URLRange xetRange `json:"url_range"`
+}
+
+// https://github.com/huggingface/xet-core/blob/main/cas_types/src/lib.rs
+type xetReconstruction struct {
+	OffsetIntoFirstRange int64                     `json:"offset_into_first_range"`
+	Terms                []xetTerm                 `json:"terms"`
+	FetchInfo            map[string][]xetFetchInfo `json:"fetch_info"`
+}
+
+// downloadXet downloads the file x from Xet into blob and, when verify is
+// true, verifies that its hash is etag.
+//
+// The file is the concatenation of terms, each a range of chunks in a xorb, as
+// listed by the CAS server. The xorb ranges downloaded are kept in
+// $HF_HOME/xet/go-chunk-cache/<xorb>/<start>-<end> so chunks shared between
+// files, e.g. between the revisions of a model, are downloaded only once. The
+// cache is trimmed to c.XetCacheSize afterward.
+//
+// The content is written to blob + ".xet.incomplete" which is renamed to blob
+// once complete. On failure, the partial file is deleted and the progress
+// reverted so the caller can fall back to a plain HTTP download, which resumes
+// the partial file of a previous HTTP download, if any.
+func (c *Client) downloadXet(ctx context.Context, x *xetFile, blob, etag string, verify bool, size int64, pr *fileProgress) error {
+	casURL, token, err := c.getXetToken(ctx, x.refreshRoute)
+	if err != nil {
+		return err
+	}
+	rec := xetReconstruction{}
+	u := casURL + "/v1/reconstructions/" + x.hash
+	resp, err := c.requestToken(ctx, c.h, "GET", u, token, nil, nil, true)
+	if err != nil {
+		return err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&rec)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", u, err)
+	}
+	var total int64
+	for _, t := range rec.Terms {
+		total += t.UnpackedLength
+	}
+	if total-rec.OffsetIntoFirstRange != size {
+		return fmt.Errorf("xet file %s: reconstruction has %d bytes, expected %d", x.hash, total-rec.OffsetIntoFirstRange, size)
+	}
+
+	tmp := blob + ".xet.incomplete"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if c.XetCacheSize > 0 {
+		defer func() {
+			if err := c.trimXetCache(); err != nil {
+				slog.Warn("hf", "message", "failed to trim xet cache", "err", err)
+			}
+		}()
+	}
+	h := newBlobHash(etag, size)
+	cw := &countWriter{}
+	w := io.MultiWriter(f, h, pr, cw)
+	skip := rec.OffsetIntoFirstRange
+	for _, t := range rec.Terms {
+		var b []byte
+		if b, err = c.xetTermData(ctx, t, rec.FetchInfo[t.Hash]); err != nil {
+			break
+		}
+		b = b[min(skip, int64(len(b))):]
+		skip = 0
+		if _, err = w.Write(b); err != nil {
+			break
+		}
+	}
+	if err == nil && cw.n != size {
+		err = fmt.Errorf("xet file %s: expected %d bytes, got %d", x.hash, size, cw.n)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); err == nil && verify && got != etag {
+		err = &CorruptedError{URL: u, Want: etag, Got: got}
+	}
+	if err == nil {
+		if err = os.Rename(tmp, blob); err == nil {
+			// The partial HTTP download is not needed anymore.
+			_ = os.Remove(blob + ".incomplete")
+		}
+		return err
+	}
+	_ = os.Remove(tmp)
+	pr.add(-cw.n)
+	return err
+}
+
+// countWriter counts the bytes written.
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+	return len(b), nil
+}
+
+// xetTermData returns the uncompressed content of the term.
+//
+// The Xet hashes of the chunks are not verified, as it requires BLAKE3. Only
+// the size of each chunk and of the term is checked. A cached range that fails
+// the check is deleted and downloaded again.
+func (c *Client) xetTermData(ctx context.Context, t xetTerm, infos []xetFetchInfo) ([]byte, error) {
+	// The xorb hash is used as a directory name, so it must be sane.
+	if !reSHA256.MatchString(t.Hash) {
+		return nil, fmt.Errorf("invalid xorb hash %q", t.Hash)
+	}
+	cache := c.XetCacheSize > 0
+	dir := filepath.Join(c.xetCacheDir(), t.Hash)
+	var raw []byte
+	var start int64
+	var p string
+	if cache {
+		raw, start, p = xetCachedRange(dir, t.Range)
+	}
+	if raw != nil {
+		b, err := xetDecodeChunks(raw, t.Range.Start-start, t.Range.End-start)
+		if err == nil && int64(len(b)) == t.UnpackedLength {
+			// Mark it as recently used for trimXetCache.
+			now := time.Now()
+			_ = os.Chtimes(p, now, now)
+			return b, nil
+		}
+		slog.Warn("hf", "message", "discarding corrupted xet cache", "file", p, "err", err)
+		_ = os.Remove(p)
+	}
+	for _, fi := range infos {
+		if fi.Range.Start > t.Range.Start || t.Range.End > fi.Range.End {
+			continue
+		}
+		raw, err := c.xetFetch(ctx, fi)
+		if err != nil {
+			return nil, err
+		}
+		b, err := xetDecodeChunks(raw, t.Range.Start-fi.Range.Start, t.Range.End-fi.Range.Start)
+		if err != nil {
+			return nil, fmt.Errorf("xorb %s: %w", t.Hash, err)
+		}
+		if int64(len(b)) != t.UnpackedLength {
+			return nil, fmt.Errorf("xorb %s: expected %d bytes, got %d", t.Hash, t.UnpackedLength, len(b))
+		}
+		if cache {
+			p := filepath.Join(dir, fmt.Sprintf("%d-%d", fi.Range.Start, fi.Range.End))
+			if err = os.MkdirAll(dir, 0o777); err == nil {
+				err = writeFileAtomic(p, raw)
+			}
+			if err != nil {
+				slog.Warn("hf", "message", "failed to cache xorb range", "file", p, "err", err)
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("xorb %s: no fetch information for chunks [%d, %d)", t.Hash, t.Range.Start, t.Range.End)
+}
+
+// xetCacheDir returns the directory of the chunk cache.
+//
+// It is distinct from $HF_HOME/xet/chunk-cache, owned by the python client
+// with a different format.
+func (c *Client) xetCacheDir() string {
+	return filepath.Join(c.hubHomeDir, "xet", "go-chunk-cache")
+}
+
+// trimXetCache deletes the least recently used xorb ranges until the chunk
+// cache fits in c.XetCacheSize.
+func (c *Client) trimXetCache() error {
+	type entry struct {
+		p    string
+		size int64
+		mod  time.Time
+	}
+	var entries []entry
+	var total int64
+	root := c.xetCacheDir()
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip the temporary files of writeFileAtomic still being written.
+		if d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			// Deleted concurrently.
+			return nil
+		}
+		entries = append(entries, entry{p, fi.Size(), fi.ModTime()})
+		total += fi.Size()
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) || total <= c.XetCacheSize {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return a.mod.Compare(b.mod)
+	})
+	slog.Info("hf", "message", "trimming xet cache", "size", total, "max", c.XetCacheSize)
+	for _, e := range entries {
+		if total <= c.XetCacheSize {
+			break
+		}
+		if err = os.Remove(e.p); err == nil || errors.Is(err, fs.ErrNotExist) {
+			total -= e.size
+		}
+		// Only succeeds when the xorb directory is empty.
+		_ = os.Remove(filepath.Dir(e.p))
+	}
+	return nil
+}
+
+// xetCachedRange returns the content of a cached range of chunks of the xorb
+// in dir containing r, the index of its first chunk and its path.
+//
+// Returns nil if not found.
+func xetCachedRange(dir string, r xetRange) ([]byte, int64, string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, ""
+	}
+	for _, entry := range entries {
+		// Skip the temporary files of writeFileAtomic.
+		s, e, ok := strings.Cut(entry.Name(), "-")
+		if !ok {
+			continue
+		}
+		start, err1 := strconv.ParseInt(s, 10, 64)
+		end, err2 := strconv.ParseInt(e, 10, 64)
+		if err1 != nil || err2 != nil || start > r.Start || r.End > end {
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		if b, err := os.ReadFile(p); err == nil {
+			return b, start, p
+		}
+	}
+	return nil, 0, ""
+}
+
+// xetFetch downloads the range of chunks of a xorb described by fi.
+func (c *Client) xetFetch(ctx context.Context, fi xetFetchInfo) ([]byte, error) {
+	// The URL is presigned, the token must not be sent.
+	hdr := map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", fi.URLRange.Start, fi.URLRange.End)}
+	resp, err := c.requestToken(ctx, c.h, "GET", fi.URL, "", hdr, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(c.throttle(ctx, resp.Body))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK && int64(len(b)) > fi.URLRange.End {
+		// The server ignored the Range request and sent the whole xorb.
+		b = b[fi.URLRange.Start : fi.URLRange.End+1]
+	}
+	if want := fi.URLRange.End - fi.URLRange.Start + 1; int64(len(b)) != want {
+		return nil, fmt.Errorf("fetching %s: expected %d bytes, got %d", fi.URL, want, len(b))
+	}
+	return b, nil
+}
+
+// Compression schemes of a xorb chunk.
+const (
+	xetNone             = 0
+	xetLZ4              = 1
+	xetByteGrouping4LZ4 = 2
+)
+
+// xetChunkHeaderLength is the size of the header preceding each chunk in a
+// xorb.
+const xetChunkHeaderLength = 8
+
+// xetDecodeChunks decompresses the chunks [start, end) of data, a sequence of
+// serialized chunks starting at index 0.
+//
+// Each chunk has an 8 bytes header: the version (0), the compressed size on 3
+// bytes, the compression scheme and the uncompressed size on 3 bytes, all
+// little endian.
+func xetDecodeChunks(data []byte, start, end int64) ([]byte, error) {
+	var out []byte
+	for i := int64(0); i < end; i++ {
+		if len(data) < xetChunkHeaderLength {
+			return nil, fmt.Errorf("chunk %d: truncated header", i)
+		}
+		if data[0] != 0 {
+			return nil, fmt.Errorf("chunk %d: unsupported version %d", i, data[0])
+		}
+		csize := int(data[1]) | int(data[2])<<8 | int(data[3])<<16
+		scheme := data[4]
+		usize := int(data[5]) | int(data[6])<<8 | int(data[7])<<16
+		if len(data) < xetChunkHeaderLength+csize {
+			return nil, fmt.Errorf("chunk %d: truncated data", i)
+		}
+		chunk := data[xetChunkHeaderLength : xetChunkHeaderLength+csize]
+		data = data[xetChunkHeaderLength+csize:]
+		if i < start {
+			continue
+		}
+		n := len(out)
+		var err error
+		switch scheme {
+		case xetNone:
+			out = append(out, chunk...)
+		case xetLZ4:
+			out, err = lz4DecodeFrame(out, chunk)
+		case xetByteGrouping4LZ4:
+			var b []byte
+			if b, err = lz4DecodeFrame(nil, chunk); err == nil {
+				out = append(out, xetUngroup4(b)...)
+			}
+		default:
+			err = fmt.Errorf("unsupported compression scheme %d", scheme)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if len(out)-n != usize {
+			return nil, fmt.Errorf("chunk %d: expected %d bytes, got %d", i, usize, len(out)-n)
+		}
+	}
+	return out, nil
+}
+
+// xetUngroup4 reverses the byte grouping of the ByteGrouping4LZ4 scheme, which
+// stores the bytes at positions 0, 4, 8, ... first, then the ones at 1, 5, 9,
+// ..., and so on.
+func xetUngroup4(b []byte) []byte {
+	out := make([]byte, len(b))
+	i := 0
+	for g := 0; g < 4; g++ {
+		for j := g; j < len(b); j += 4 {
+			out[j] = b[i]
+			i++
+		}
+	}
+	return out
+}
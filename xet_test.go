@@ -0,0 +1,442 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package huggingface
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCAS is a minimal Xet CAS server, also serving the token refresh route.
+type fakeCAS struct {
+	t      testing.TB
+	server *httptest.Server
+	// xorbs is the serialized chunks of each xorb.
+	xorbs map[string][]byte
+	// files is the reconstruction of each file by Xet hash.
+	files map[string]xetReconstruction
+
+	mu sync.Mutex
+	// fetches is the number of GET requests per xorb.
+	fetches map[string]int
+}
+
+func (f *fakeCAS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch p := r.URL.Path; {
+	case p == "/token":
+		_ = json.NewEncoder(w).Encode(xetTokenResponse{CasURL: f.server.URL, AccessToken: "xet_token", Exp: time.Now().Add(time.Hour).Unix()})
+	case strings.HasPrefix(p, "/v1/reconstructions/"):
+		// https://github.com/huggingface/xet-core/blob/main/cas_client/src/remote_client.rs
+		if a := r.Header.Get("Authorization"); a != "Bearer xet_token" {
+			f.t.Errorf("unexpected authorization %q", a)
+		}
+		rec, ok := f.files[strings.TrimPrefix(p, "/v1/reconstructions/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(rec)
+	case strings.HasPrefix(p, "/xorb/"):
+		if a := r.Header.Get("Authorization"); a != "" {
+			f.t.Errorf("token sent to presigned URL: %q", a)
+		}
+		name := strings.TrimPrefix(p, "/xorb/")
+		f.mu.Lock()
+		f.fetches[name]++
+		f.mu.Unlock()
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(f.xorbs[name]))
+	default:
+		f.t.Errorf("unexpected path %s", p)
+		http.NotFound(w, r)
+	}
+}
+
+// xetChunk serializes a chunk compressed with the scheme.
+func xetChunk(scheme byte, data []byte) []byte {
+	c := data
+	switch scheme {
+	case xetLZ4:
+		c = lz4Literals(data)
+	case xetByteGrouping4LZ4:
+		var g []byte
+		for i := 0; i < 4; i++ {
+			for j := i; j < len(data); j += 4 {
+				g = append(g, data[j])
+			}
+		}
+		c = lz4Literals(g)
+	}
+	return append([]byte{0, byte(len(c)), byte(len(c) >> 8), byte(len(c) >> 16), scheme, byte(len(data)), byte(len(data) >> 8), byte(len(data) >> 16)}, c...)
+}
+
+var (
+	xorb1    = strings.Repeat("1", 64)
+	xorb2    = strings.Repeat("2", 64)
+	xetHash1 = strings.Repeat("a", 64)
+	xetHash2 = strings.Repeat("b", 64)
+)
+
+// newFakeXet returns a fake Hub serving the model "author/repo" with the files
+// "a.bin" and "b.bin" stored on Xet, and the fake CAS server.
+//
+// "a.bin" is made of the 3 chunks of xorb1, each with a different compression
+// scheme. "b.bin" is made of the 2 last chunks of xorb1 and the chunk of
+// xorb2.
+func newFakeXet(t testing.TB) (*fakeHub, *fakeCAS, *Client) {
+	chunks := [][]byte{[]byte("stored as is;"), []byte("compressed with lz4;"), []byte("byte grouped")}
+	c0, c1, c2 := xetChunk(xetNone, chunks[0]), xetChunk(xetLZ4, chunks[1]), xetChunk(xetByteGrouping4LZ4, chunks[2])
+	x1 := append(append(append([]byte{}, c0...), c1...), c2...)
+	x2 := xetChunk(xetLZ4, []byte("+more"))
+	a := append(append(append([]byte{}, chunks[0]...), chunks[1]...), chunks[2]...)
+	b := append(append(append([]byte{}, chunks[1]...), chunks[2]...), "+more"...)
+
+	cas := &fakeCAS{t: t, xorbs: map[string][]byte{xorb1: x1, xorb2: x2}, fetches: map[string]int{}}
+	cas.server = httptest.NewServer(cas)
+	t.Cleanup(cas.server.Close)
+	cas.files = map[string]xetReconstruction{
+		xetHash1: {
+			Terms: []xetTerm{{Hash: xorb1, UnpackedLength: int64(len(a)), Range: xetRange{0, 3}}},
+			FetchInfo: map[string][]xetFetchInfo{
+				xorb1: {{Range: xetRange{0, 3}, URL: cas.server.URL + "/xorb/" + xorb1, URLRange: xetRange{0, int64(len(x1) - 1)}}},
+			},
+		},
+		xetHash2: {
+			Terms: []xetTerm{
+				{Hash: xorb1, UnpackedLength: int64(len(chunks[1]) + len(chunks[2])), Range: xetRange{1, 3}},
+				{Hash: xorb2, UnpackedLength: 5, Range: xetRange{0, 1}},
+			},
+			FetchInfo: map[string][]xetFetchInfo{
+				xorb1: {{Range: xetRange{1, 3}, URL: cas.server.URL + "/xorb/" + xorb1, URLRange: xetRange{int64(len(c0)), int64(len(x1) - 1)}}},
+				xorb2: {{Range: xetRange{0, 1}, URL: cas.server.URL + "/xorb/" + xorb2, URLRange: xetRange{0, int64(len(x2) - 1)}}},
+			},
+		},
+	}
+	f, c := newFakeHub(t, map[string][]byte{"a.bin": a, "b.bin": b})
+	f.xet = map[string]string{"a.bin": xetHash1, "b.bin": xetHash2}
+	f.casURL = cas.server.URL
+	f.headers = func(name string, h http.Header) {
+		h.Set("Link", "<"+cas.server.URL+"/token>; rel=\"xet-auth\", <https://example.com>; rel=\"other\"")
+	}
+	return f, cas, c
+}
+
+func TestEnsureFile_Xet(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	for _, name := range []string{"a.bin", "b.bin"} {
+		p, err := c.EnsureFile(ctx, ref, "main", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, f.files[name]) {
+			t.Fatalf("content mismatch for %s: %q, %v", name, got, err)
+		}
+	}
+	if len(f.ranges) != 0 {
+		t.Fatalf("unexpected HTTP downloads %q", f.ranges)
+	}
+	// The chunks of xorb1 needed by b.bin were found in the chunk cache.
+	if cas.fetches[xorb1] != 1 || cas.fetches[xorb2] != 1 {
+		t.Fatalf("unexpected fetches %v", cas.fetches)
+	}
+}
+
+func TestEnsureSnapshot_Xet(t *testing.T) {
+	for _, noBlobs := range []bool{false, true} {
+		t.Run(map[bool]string{false: "blobs", true: "no_blobs"}[noBlobs], func(t *testing.T) {
+			f, cas, c := newFakeXet(t)
+			f.noBlobs = noBlobs
+			ref := ModelRef{Author: "author", Repo: "repo"}
+			got, err := c.EnsureSnapshot(context.Background(), ref, "main", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range got {
+				b, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, f.files[filepath.Base(p)]) {
+					t.Fatalf("content mismatch for %s", p)
+				}
+			}
+			if len(got) != 2 || len(f.ranges) != 0 {
+				t.Fatalf("unexpected files %q or HTTP downloads %q", got, f.ranges)
+			}
+			if cas.fetches[xorb2] != 1 {
+				t.Fatalf("unexpected fetches %v", cas.fetches)
+			}
+			// The Xet hash in the files metadata saves the HEAD requests.
+			want := 0
+			if noBlobs {
+				want = 2
+			}
+			if f.heads != want {
+				t.Fatalf("want %d HEAD requests, got %d", want, f.heads)
+			}
+		})
+	}
+}
+
+func TestEnsureSnapshot_XetProbe(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	// The files metadata doesn't have the Xet hashes, only the resolve
+	// responses do.
+	xet := f.xet
+	f.xet = nil
+	headers := f.headers
+	f.headers = func(name string, h http.Header) {
+		headers(name, h)
+		h.Set("X-Xet-Hash", xet[name])
+	}
+	c.Connections = 2
+	c.ChunkSize = 10
+	got, err := c.EnsureSnapshot(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range got {
+		if b, err := os.ReadFile(p); err != nil || !bytes.Equal(b, f.files[filepath.Base(p)]) {
+			t.Fatalf("content mismatch for %s: %v", p, err)
+		}
+	}
+	// A single request per file, whose response is not read.
+	if f.heads != 0 || len(f.ranges) != 2 {
+		t.Fatalf("unexpected %d HEAD requests or HTTP downloads %q", f.heads, f.ranges)
+	}
+	if cas.fetches[xorb2] != 1 {
+		t.Fatalf("unexpected fetches %v", cas.fetches)
+	}
+	matches, _ := filepath.Glob(filepath.Join(c.hubCacheDir, "models--author--repo", "blobs", "*.incomplete"))
+	if len(matches) != 0 {
+		t.Fatalf("unexpected partial files %q", matches)
+	}
+}
+
+func TestEnsureFile_XetEtag(t *testing.T) {
+	f, _, c := newFakeXet(t)
+	headers := f.headers
+	f.headers = func(name string, h http.Header) {
+		headers(name, h)
+		h.Set("X-Linked-Etag", "\"xet-etag\"")
+	}
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	_, etag, _, err := c.GetFileInfo(ctx, ref, fakeCommit, "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != xetHash1 {
+		t.Fatal(etag)
+	}
+	p, err := c.EnsureFile(ctx, ref, "main", "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The blob is named after the Xet hash.
+	blob, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(blob) != xetHash1 {
+		t.Fatal(blob)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, f.files["a.bin"]) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+}
+
+func TestEnsureFile_XetFallback(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	// The CAS server doesn't know the file.
+	delete(cas.files, xetHash1)
+	p, err := c.EnsureFile(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, f.files["a.bin"]) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	if len(f.ranges) != 1 {
+		t.Fatalf("expected an HTTP download, got %q", f.ranges)
+	}
+	matches, _ := filepath.Glob(filepath.Join(c.hubCacheDir, "models--author--repo", "blobs", "*.incomplete"))
+	if len(matches) != 0 {
+		t.Fatalf("unexpected partial files %q", matches)
+	}
+}
+
+func TestEnsureFile_XetFallbackResume(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	// The reconstruction succeeds but not the xorb download.
+	cas.xorbs[xorb1] = nil
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	_, etag, _, err := c.GetFileInfo(ctx, ref, fakeCommit, "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdlDir, err := c.prepareModelCache(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate an interrupted HTTP download.
+	if err = os.WriteFile(filepath.Join(mdlDir, "blobs", etag+".incomplete"), f.files["a.bin"][:10], 0o666); err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.EnsureFile(ctx, ref, "main", "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, f.files["a.bin"]) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	// The failed Xet attempt left the partial file alone.
+	if len(f.ranges) != 1 || f.ranges[0] != "bytes=10-" {
+		t.Fatalf("expected a resumed HTTP download, got %q", f.ranges)
+	}
+}
+
+func TestXetDecodeChunks_Error(t *testing.T) {
+	valid := xetChunk(xetNone, []byte("abc"))
+	data := []struct {
+		name string
+		in   []byte
+	}{
+		{"truncated_header", valid[:5]},
+		{"truncated_data", valid[:9]},
+		{"version", append([]byte{1}, valid[1:]...)},
+		{"scheme", append(append([]byte{}, valid[:4]...), append([]byte{9}, valid[5:]...)...)},
+		{"size", append(append([]byte{}, valid[:5]...), append([]byte{4}, valid[6:]...)...)},
+	}
+	for _, l := range data {
+		t.Run(l.name, func(t *testing.T) {
+			if _, err := xetDecodeChunks(l.in, 0, 1); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+// xetCacheSize returns the total size of the files in the Xet chunk cache.
+func xetCacheSize(t testing.TB, c *Client) int64 {
+	var total int64
+	err := filepath.WalkDir(c.xetCacheDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		total += fi.Size()
+		return err
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return total
+}
+
+func TestEnsureFile_XetCacheSize(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	// The cache holds xorb1 but not both xorbs.
+	c.XetCacheSize = int64(len(cas.xorbs[xorb1]))
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if _, err := c.EnsureFile(ctx, ref, "main", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := xetCacheSize(t, c); got == 0 || got > c.XetCacheSize {
+		t.Fatalf("unexpected cache size %d", got)
+	}
+	// The python client's cache is left alone.
+	if _, err := os.Stat(filepath.Join(c.hubHomeDir, "xet", "chunk-cache")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	// The cache is disabled.
+	if err := os.RemoveAll(c.hubHomeDir); err != nil {
+		t.Fatal(err)
+	}
+	c.XetCacheSize = 0
+	if _, err := c.EnsureFile(ctx, ref, "main", "b.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got := xetCacheSize(t, c); got != 0 {
+		t.Fatalf("unexpected cache size %d", got)
+	}
+	if len(f.ranges) != 0 {
+		t.Fatalf("unexpected HTTP downloads %q", f.ranges)
+	}
+}
+
+func TestEnsureFile_XetCorruptedCache(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	ctx := context.Background()
+	ref := ModelRef{Author: "author", Repo: "repo"}
+	if _, err := c.EnsureFile(ctx, ref, "main", "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	// Change the uncompressed size of the first chunk in the cache.
+	p := filepath.Join(c.xetCacheDir(), xorb1, "0-3")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[5]++
+	if err = os.WriteFile(p, b, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(c.hubCacheDir); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = c.EnsureFile(ctx, ref, "main", "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, f.files["a.bin"]) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	// The corrupted range was discarded and downloaded again.
+	if cas.fetches[xorb1] != 2 || len(f.ranges) != 0 {
+		t.Fatalf("unexpected fetches %v or HTTP downloads %q", cas.fetches, f.ranges)
+	}
+}
+
+func TestEnsureFile_XetUnpackedLength(t *testing.T) {
+	f, cas, c := newFakeXet(t)
+	rec := cas.files[xetHash2]
+	rec.Terms = slices.Clone(rec.Terms)
+	// The total is right but not the size of each term.
+	rec.Terms[0].UnpackedLength++
+	rec.Terms[1].UnpackedLength--
+	cas.files[xetHash2] = rec
+	p, err := c.EnsureFile(context.Background(), ModelRef{Author: "author", Repo: "repo"}, "main", "b.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(p); err != nil || !bytes.Equal(got, f.files["b.bin"]) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	// The mismatch made it fall back to HTTP and the range was not cached.
+	if len(f.ranges) != 1 {
+		t.Fatalf("expected an HTTP download, got %q", f.ranges)
+	}
+	if got := xetCacheSize(t, c); got != 0 {
+		t.Fatalf("unexpected cache size %d", got)
+	}
+}